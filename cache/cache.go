@@ -1,63 +1,251 @@
 package cache
 
 import (
+	"container/heap"
+	"container/list"
 	"sync"
+	"time"
 	"wb-orders-service/models"
 )
 
+// Options задает ограничения размера и времени жизни записей кэша
+type Options struct {
+	MaxEntries      int           // максимум заказов, 0 - без ограничения
+	MaxBytes        int64         // максимум оценочного объема в байтах, 0 - без ограничения
+	TTL             time.Duration // время жизни записи по умолчанию, 0 - бессрочно
+	Sliding         bool          // продлевать время жизни при каждом чтении
+	JanitorInterval time.Duration // период удаления истекших записей, 0 - раз в минуту
+	Shards          int           // число сегментов для NewStore, <= 1 - один сегмент
+}
+
+type entry struct {
+	order     *models.Order
+	size      int64
+	ttl       time.Duration
+	expiresAt time.Time // нулевое значение - бессрочно
+	index     int       // позиция в куче expiry, -1 - записи там нет
+}
+
+// Cache - LRU кэш заказов с ограничением по количеству и объему и временем жизни записей.
+// Вытесняются давно не запрашивавшиеся и истекшие заказы, они остаются доступны из БД.
+// Кэш хранит собственные копии заказов и отдает копии, поэтому изменение
+// полученного или сохраненного заказа не влияет на содержимое кэша.
 type Cache struct {
-	mu    sync.RWMutex
-	data  map[string]*models.Order
+	mu     sync.Mutex
+	opts   Options
+	data   map[string]*list.Element
+	lru    *list.List // в начале - недавно использованные
+	expiry expiryHeap
+	bytes  int64
+
+	counters counters
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// New создает кэш и запускает фоновое удаление истекших записей (остановить - Close)
+func New(opts Options) *Cache {
+	c := newCache(opts)
+	go c.janitor()
+	return c
 }
 
-func New() *Cache {
+func newCache(opts Options) *Cache {
 	return &Cache{
-		data: make(map[string]*models.Order),
+		opts: opts,
+		data: make(map[string]*list.Element),
+		lru:  list.New(),
+		stop: make(chan struct{}),
 	}
 }
 
-// Get возвращает заказ по order_uid
+// Close останавливает фоновое удаление истекших записей
+func (c *Cache) Close() {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+// Get возвращает копию заказа по order_uid и отмечает его как недавно использованный
 func (c *Cache) Get(orderUID string) (*models.Order, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.data[orderUID]
+	if !exists {
+		c.counters.misses.Add(1)
+		return nil, false
+	}
 
-	order, exists := c.data[orderUID]
-	return order, exists
+	e := elem.Value.(*entry)
+	now := time.Now()
+	if !e.expiresAt.IsZero() && !e.expiresAt.After(now) {
+		c.removeElement(elem)
+		c.counters.expirations.Add(1)
+		c.counters.misses.Add(1)
+		return nil, false
+	}
+	if c.opts.Sliding {
+		c.setExpiry(e, now)
+	}
+	c.lru.MoveToFront(elem)
+	c.counters.hits.Add(1)
+	return e.order.Clone(), true
 }
 
-// Set сохраняет заказ в кэш
+// Set сохраняет заказ в кэш с временем жизни по умолчанию
 func (c *Cache) Set(order *models.Order) {
+	c.SetWithTTL(order, 0)
+}
+
+// SetWithTTL сохраняет заказ с собственным временем жизни (ttl <= 0 - по умолчанию).
+// При переполнении вытесняет давно не использованные записи.
+func (c *Cache) SetWithTTL(order *models.Order, ttl time.Duration) {
+	order = order.Clone()
+	size := estimateSize(order)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ttl <= 0 {
+		ttl = c.opts.TTL
+	}
+
+	if elem, exists := c.data[order.OrderUID]; exists {
+		c.removeElement(elem)
+	}
+
+	// Заказ больше всего кэша не сохраняем, иначе он вытеснит все остальные
+	if c.opts.MaxBytes > 0 && size > c.opts.MaxBytes {
+		return
+	}
+
+	e := &entry{order: order, size: size, ttl: ttl, index: -1}
+	c.setExpiry(e, time.Now())
+	c.data[order.OrderUID] = c.lru.PushFront(e)
+	c.bytes += size
+	c.evict()
+}
+
+// WarmResult - чем закончилось добавление заказа при прогреве
+type WarmResult int
+
+const (
+	WarmAdded   WarmResult = iota // заказ в кэше
+	WarmSkipped                   // для заказа нет места, но кэш еще не заполнен
+	WarmFull                      // кэш заполнен, прогрев можно остановить
+)
+
+// Warm добавляет заказ как давно не использованный, не вытесняя другие записи.
+// Предназначен для прогрева от новых заказов к старым: более старые заказы
+// оказываются в конце LRU и вытесняются первыми. Уже закэшированный заказ
+// не перезаписывается. Возвращает WarmFull, если места в кэше больше нет.
+func (c *Cache) Warm(order *models.Order, ttl time.Duration) WarmResult {
+	order = order.Clone()
+	size := estimateSize(order)
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.data[order.OrderUID] = order
+	if _, exists := c.data[order.OrderUID]; exists {
+		return WarmAdded
+	}
+	if (c.opts.MaxEntries > 0 && c.lru.Len() >= c.opts.MaxEntries) ||
+		(c.opts.MaxBytes > 0 && c.bytes+size > c.opts.MaxBytes) {
+		return WarmFull
+	}
+
+	if ttl <= 0 {
+		ttl = c.opts.TTL
+	}
+	e := &entry{order: order, size: size, ttl: ttl, index: -1}
+	c.setExpiry(e, time.Now())
+	c.data[order.OrderUID] = c.lru.PushBack(e)
+	c.bytes += size
+	return WarmAdded
 }
 
-// GetAll возвращает все заказы в кэше (для отладки)
+// SetOptions меняет ограничения и сразу вытесняет лишние записи.
+// Новый TTL применяется к записям, сохраненным после вызова.
+func (c *Cache) SetOptions(opts Options) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.opts = opts
+	c.evict()
+}
+
+// GetAll возвращает копии всех заказов в кэше (для отладки)
 func (c *Cache) GetAll() map[string]*models.Order {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	// Создаем копию чтобы избежать гонок данных
-	result := make(map[string]*models.Order)
-	for k, v := range c.data {
-		result[k] = v
+	result := make(map[string]*models.Order, len(c.data))
+	for k, elem := range c.data {
+		result[k] = elem.Value.(*entry).order.Clone()
 	}
 	return result
 }
 
 // Size возвращает количество элементов в кэше
 func (c *Cache) Size() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	return len(c.data)
 }
 
+// Bytes возвращает оценочный объем заказов в кэше
+func (c *Cache) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.bytes
+}
+
 // Delete удаляет заказ из кэша
 func (c *Cache) Delete(orderUID string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	delete(c.data, orderUID)
+	if elem, exists := c.data[orderUID]; exists {
+		c.removeElement(elem)
+	}
+}
+
+// Clear удаляет все записи
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.data = make(map[string]*list.Element)
+	c.lru.Init()
+	c.expiry = nil
+	c.bytes = 0
+}
+
+// evict вытесняет давно не использованные записи, пока кэш не уложится в лимиты.
+// Вызывается под c.mu.
+func (c *Cache) evict() {
+	for c.lru.Len() > 0 && c.overLimit() {
+		c.removeElement(c.lru.Back())
+		c.counters.evictions.Add(1)
+	}
+}
+
+func (c *Cache) overLimit() bool {
+	return (c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries) ||
+		(c.opts.MaxBytes > 0 && c.bytes > c.opts.MaxBytes)
+}
+
+// removeElement удаляет запись из индекса и списка. Вызывается под c.mu.
+func (c *Cache) removeElement(elem *list.Element) {
+	e := c.lru.Remove(elem).(*entry)
+	delete(c.data, e.order.OrderUID)
+	if e.index >= 0 {
+		heap.Remove(&c.expiry, e.index)
+	}
+	c.bytes -= e.size
 }
@@ -0,0 +1,203 @@
+package cache_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wb-orders-service/cache"
+	"wb-orders-service/models"
+)
+
+// Число заказов и операций каждой горутины в проверках конкурентного доступа
+const (
+	raceOrders     = 64
+	raceIterations = 2000
+)
+
+func orderUID(i int) string {
+	return "race-order-" + strconv.Itoa(i)
+}
+
+// version строит заказ, все поля которого согласованы с номером версии
+func version(i, v int) *models.Order {
+	tag := strconv.Itoa(v)
+	uid := orderUID(i)
+	return &models.Order{
+		OrderUID:    uid,
+		TrackNumber: "track-" + tag,
+		Entry:       tag,
+		Payment:     models.Payment{Transaction: uid, Amount: v},
+		Items: []models.Item{
+			{Name: "item-" + tag, Price: v},
+			{Name: "item-" + tag, Price: v},
+		},
+	}
+}
+
+// check проверяет, что заказ целиком относится к одной версии и не был изменен
+func check(order *models.Order) error {
+	tag := order.Entry
+	if order.TrackNumber != "track-"+tag {
+		return fmt.Errorf("track_number %q does not match version %s", order.TrackNumber, tag)
+	}
+	if len(order.Items) != 2 {
+		return fmt.Errorf("expected 2 items, got %d", len(order.Items))
+	}
+	for _, item := range order.Items {
+		if item.Name != "item-"+tag || strconv.Itoa(item.Price) != tag {
+			return fmt.Errorf("item %q/%d does not match version %s", item.Name, item.Price, tag)
+		}
+	}
+	if strconv.Itoa(order.Payment.Amount) != tag {
+		return fmt.Errorf("payment amount %d does not match version %s", order.Payment.Amount, tag)
+	}
+	return nil
+}
+
+// testConcurrentCopies проверяет, что конкурентные читатели и писатели не видят
+// частично обновленных заказов и не портят кэш, изменяя полученные копии.
+// Полезна с детектором гонок: go test -race ./cache
+func testConcurrentCopies(t *testing.T, store cache.Store) {
+	for i := 0; i < raceOrders; i++ {
+		store.Set(version(i, 0))
+	}
+
+	var wg sync.WaitGroup
+
+	// Писатели сохраняют новые версии заказов и продолжают менять свои экземпляры
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := 1; v <= raceIterations; v++ {
+				order := version((v*4+w)%raceOrders, v)
+				store.Set(order)
+				order.TrackNumber = "mutated-after-set"
+				order.Items[0].Name = "mutated-after-set"
+			}
+		}()
+	}
+
+	// Читатели проверяют целостность и портят полученные копии
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := r; i < r+raceIterations; i++ {
+				uid := orderUID(i % raceOrders)
+				order, ok := store.Get(uid)
+				if !ok {
+					continue
+				}
+				if err := check(order); err != nil {
+					t.Errorf("torn order %s: %v", uid, err)
+					return
+				}
+				order.TrackNumber = "mutated-after-get"
+				order.Items[0].Name = "mutated-after-get"
+				order.Items = append(order.Items, models.Item{Name: "extra"})
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestCacheConcurrentCopies(t *testing.T) {
+	t.Parallel()
+
+	store := cache.New(cache.Options{MaxEntries: raceOrders})
+	defer store.Close()
+	testConcurrentCopies(t, store)
+}
+
+func TestCacheWarmFull(t *testing.T) {
+	t.Parallel()
+
+	store := cache.New(cache.Options{MaxEntries: 1})
+	defer store.Close()
+
+	if got := store.Warm(version(0, 0), time.Minute); got != cache.WarmAdded {
+		t.Fatalf("first Warm = %v, want WarmAdded", got)
+	}
+	if got := store.Warm(version(1, 0), time.Minute); got != cache.WarmFull {
+		t.Fatalf("second Warm = %v, want WarmFull", got)
+	}
+	if _, ok := store.Get(orderUID(0)); !ok {
+		t.Fatal("warmed order evicted")
+	}
+}
+
+// Заказов в кэше для бенчмарков
+const benchOrders = 100000
+
+// Доли чтений в смешанной нагрузке бенчмарков, %
+var benchReadPercents = []int{100, 90, 50, 10}
+
+func benchOrder(i int) *models.Order {
+	uid := fmt.Sprintf("bench-order-%08d", i)
+	return &models.Order{
+		OrderUID:    uid,
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Locale:      "en",
+		CustomerID:  "test",
+		DateCreated: time.Now(),
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+		},
+		Payment: models.Payment{
+			Transaction: uid,
+			Currency:    "USD",
+			Amount:      1817,
+		},
+		Items: []models.Item{
+			{ChrtID: int64(i), Rid: uid + "-rid", Name: "Mascaras", Brand: "Vivienne Sabo", Price: 453},
+		},
+	}
+}
+
+// benchmarkMixed выполняет Get и Set в пропорциях benchReadPercents из всех
+// горутин сразу, число горутин задает -cpu:
+//
+//	go test -run '^$' -bench 'BenchmarkCache' -cpu 1,8 ./cache
+func benchmarkMixed(b *testing.B, newStore func() cache.Store) {
+	orders := make([]*models.Order, benchOrders)
+	for i := range orders {
+		orders[i] = benchOrder(i)
+	}
+
+	for _, readPercent := range benchReadPercents {
+		b.Run(fmt.Sprintf("reads=%d%%", readPercent), func(b *testing.B) {
+			store := newStore()
+			defer store.Close()
+			for _, order := range orders {
+				store.Set(order)
+			}
+
+			var seed atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rnd := rand.New(rand.NewSource(seed.Add(1)))
+				for pb.Next() {
+					order := orders[rnd.Intn(len(orders))]
+					if rnd.Intn(100) < readPercent {
+						store.Get(order.OrderUID)
+					} else {
+						store.Set(order)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkCache(b *testing.B) {
+	benchmarkMixed(b, func() cache.Store { return cache.New(cache.Options{}) })
+}
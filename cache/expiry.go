@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Сколько записей janitor удаляет за один захват блокировки
+const janitorBatch = 256
+
+// expiryHeap - min-heap записей по времени истечения
+type expiryHeap []*entry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
+
+// setExpiry выставляет время истечения записи и обновляет ее позицию в куче.
+// Вызывается под c.mu.
+func (c *Cache) setExpiry(e *entry, now time.Time) {
+	if e.ttl <= 0 {
+		return
+	}
+	e.expiresAt = now.Add(e.ttl)
+	if e.index >= 0 {
+		heap.Fix(&c.expiry, e.index)
+	} else {
+		heap.Push(&c.expiry, e)
+	}
+}
+
+// RemoveExpired удаляет истекшие записи небольшими порциями, отпуская
+// блокировку между порциями, чтобы не задерживать чтения. Возвращает число удаленных.
+func (c *Cache) RemoveExpired() int {
+	total := 0
+	for {
+		n := c.removeExpiredBatch(time.Now(), janitorBatch)
+		total += n
+		if n < janitorBatch {
+			return total
+		}
+	}
+}
+
+func (c *Cache) removeExpiredBatch(now time.Time, limit int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for removed < limit && len(c.expiry) > 0 && !c.expiry[0].expiresAt.After(now) {
+		c.removeElement(c.data[c.expiry[0].order.OrderUID])
+		removed++
+	}
+	c.counters.expirations.Add(uint64(removed))
+	return removed
+}
+
+// janitor периодически удаляет истекшие записи до вызова Close
+func (c *Cache) janitor() {
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(c.janitorInterval()):
+			c.RemoveExpired()
+		}
+	}
+}
+
+// janitorInterval возвращает текущий период janitor, он может меняться через SetOptions
+func (c *Cache) janitorInterval() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.opts.JanitorInterval <= 0 {
+		return time.Minute
+	}
+	return c.opts.JanitorInterval
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Negative - кэш order_uid, которых нет в БД. Защищает БД от повторных
+// запросов несуществующих заказов (сканеры, опечатки). Записи живут недолго
+// и вытесняются по LRU при превышении лимита.
+type Negative struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration // 0 - кэш отключен
+	data       map[string]*list.Element
+	lru        *list.List
+	generation uint64
+}
+
+type negativeEntry struct {
+	orderUID  string
+	expiresAt time.Time
+}
+
+func NewNegative(maxEntries int, ttl time.Duration) *Negative {
+	return &Negative{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		data:       make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Contains сообщает, известно ли, что заказа нет в БД
+func (n *Negative) Contains(orderUID string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	elem, exists := n.data[orderUID]
+	if !exists {
+		return false
+	}
+	if !elem.Value.(*negativeEntry).expiresAt.After(time.Now()) {
+		n.remove(elem)
+		return false
+	}
+	return true
+}
+
+// Generation возвращает номер поколения. Его нужно взять до запроса в БД
+// и передать в Add: если за время запроса заказы сохранялись, результат устарел.
+func (n *Negative) Generation() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.generation
+}
+
+// Add запоминает отсутствие заказа, если с момента Generation не сохранялся ни один
+// заказ (Remove): иначе заказ мог появиться в БД после запроса
+func (n *Negative) Add(orderUID string, generation uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.ttl <= 0 || generation != n.generation {
+		return
+	}
+
+	if elem, exists := n.data[orderUID]; exists {
+		n.remove(elem)
+	}
+	n.data[orderUID] = n.lru.PushFront(&negativeEntry{orderUID: orderUID, expiresAt: time.Now().Add(n.ttl)})
+	for n.maxEntries > 0 && n.lru.Len() > n.maxEntries {
+		n.remove(n.lru.Back())
+	}
+}
+
+// Remove забывает об отсутствии заказа и отменяет Add, начатые до вызова.
+// Вызывается после сохранения заказа в БД.
+func (n *Negative) Remove(orderUID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.generation++
+	if elem, exists := n.data[orderUID]; exists {
+		n.remove(elem)
+	}
+}
+
+// SetLimits меняет лимиты, ttl = 0 отключает кэш и очищает его
+func (n *Negative) SetLimits(maxEntries int, ttl time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.maxEntries = maxEntries
+	n.ttl = ttl
+	for n.lru.Len() > 0 && (ttl <= 0 || (maxEntries > 0 && n.lru.Len() > maxEntries)) {
+		n.remove(n.lru.Back())
+	}
+}
+
+// Size возвращает число запомненных order_uid
+func (n *Negative) Size() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return len(n.data)
+}
+
+func (n *Negative) remove(elem *list.Element) {
+	e := n.lru.Remove(elem).(*negativeEntry)
+	delete(n.data, e.orderUID)
+}
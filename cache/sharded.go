@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wb-orders-service/models"
+)
+
+// Store - общий интерфейс Cache и Sharded
+type Store interface {
+	Get(orderUID string) (*models.Order, bool)
+	Set(order *models.Order)
+	SetWithTTL(order *models.Order, ttl time.Duration)
+	Warm(order *models.Order, ttl time.Duration) WarmResult
+	Delete(orderUID string)
+	GetAll() map[string]*models.Order
+	Size() int
+	Bytes() int64
+	Clear()
+	SetOptions(opts Options)
+	RemoveExpired() int
+	Stats() Stats
+	WriteSnapshot(w io.Writer, watermark time.Time) (SnapshotInfo, error)
+	LoadSnapshot(r io.Reader) (SnapshotInfo, error)
+	SaveSnapshotFile(path string, watermark time.Time) (SnapshotInfo, error)
+	LoadSnapshotFile(path string) (SnapshotInfo, error)
+	Close()
+}
+
+// NewStore создает Sharded при opts.Shards > 1, иначе обычный Cache
+func NewStore(opts Options) Store {
+	if opts.Shards > 1 {
+		return NewSharded(opts)
+	}
+	return New(opts)
+}
+
+// Sharded - кэш из нескольких независимо блокируемых сегментов. Заказ попадает
+// в сегмент по хешу order_uid, поэтому запись в один сегмент не блокирует
+// чтения из остальных. Лимиты делятся между сегментами поровну, LRU
+// соблюдается в пределах сегмента.
+type Sharded struct {
+	shards []*Cache
+	full   []atomic.Bool // сегмент отказал Warm: заполнен для прогрева
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSharded создает кэш из opts.Shards сегментов и запускает общий janitor
+func NewSharded(opts Options) *Sharded {
+	n := opts.Shards
+	if n < 1 {
+		n = 1
+	}
+
+	s := &Sharded{
+		shards: make([]*Cache, n),
+		full:   make([]atomic.Bool, n),
+		stop:   make(chan struct{}),
+	}
+	shardOpts := splitOptions(opts, n)
+	for i := range s.shards {
+		s.shards[i] = newCache(shardOpts)
+	}
+
+	go s.janitor()
+	return s
+}
+
+// splitOptions делит лимиты между n сегментами с округлением вверх
+func splitOptions(opts Options, n int) Options {
+	if opts.MaxEntries > 0 {
+		opts.MaxEntries = (opts.MaxEntries + n - 1) / n
+	}
+	if opts.MaxBytes > 0 {
+		opts.MaxBytes = (opts.MaxBytes + int64(n) - 1) / int64(n)
+	}
+	return opts
+}
+
+// shard выбирает сегмент по FNV-1a хешу order_uid
+func (s *Sharded) shard(orderUID string) *Cache {
+	return s.shards[s.shardIndex(orderUID)]
+}
+
+func (s *Sharded) shardIndex(orderUID string) int {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	hash := uint32(offset32)
+	for i := 0; i < len(orderUID); i++ {
+		hash ^= uint32(orderUID[i])
+		hash *= prime32
+	}
+	return int(hash % uint32(len(s.shards)))
+}
+
+func (s *Sharded) Get(orderUID string) (*models.Order, bool) {
+	return s.shard(orderUID).Get(orderUID)
+}
+
+func (s *Sharded) Set(order *models.Order) {
+	s.shard(order.OrderUID).Set(order)
+}
+
+func (s *Sharded) SetWithTTL(order *models.Order, ttl time.Duration) {
+	s.shard(order.OrderUID).SetWithTTL(order, ttl)
+}
+
+// Warm добавляет заказ в его сегмент. Заполненный сегмент не останавливает
+// прогрев остальных: WarmFull возвращается, только когда заполнены все.
+func (s *Sharded) Warm(order *models.Order, ttl time.Duration) WarmResult {
+	i := s.shardIndex(order.OrderUID)
+	if s.shards[i].Warm(order, ttl) == WarmAdded {
+		return WarmAdded
+	}
+	s.full[i].Store(true)
+	for j := range s.full {
+		if !s.full[j].Load() {
+			return WarmSkipped
+		}
+	}
+	return WarmFull
+}
+
+func (s *Sharded) Delete(orderUID string) {
+	i := s.shardIndex(orderUID)
+	s.shards[i].Delete(orderUID)
+	s.full[i].Store(false)
+}
+
+// GetAll возвращает все заказы всех сегментов (для отладки)
+func (s *Sharded) GetAll() map[string]*models.Order {
+	result := make(map[string]*models.Order)
+	for _, shard := range s.shards {
+		for k, v := range shard.GetAll() {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func (s *Sharded) Size() int {
+	size := 0
+	for _, shard := range s.shards {
+		size += shard.Size()
+	}
+	return size
+}
+
+func (s *Sharded) Bytes() int64 {
+	var bytes int64
+	for _, shard := range s.shards {
+		bytes += shard.Bytes()
+	}
+	return bytes
+}
+
+func (s *Sharded) Clear() {
+	for i, shard := range s.shards {
+		shard.Clear()
+		s.full[i].Store(false)
+	}
+}
+
+// SetOptions меняет лимиты всех сегментов, число сегментов не меняется
+func (s *Sharded) SetOptions(opts Options) {
+	shardOpts := splitOptions(opts, len(s.shards))
+	for i, shard := range s.shards {
+		shard.SetOptions(shardOpts)
+		s.full[i].Store(false)
+	}
+}
+
+func (s *Sharded) RemoveExpired() int {
+	removed := 0
+	for _, shard := range s.shards {
+		removed += shard.RemoveExpired()
+	}
+	return removed
+}
+
+// Stats суммирует счетчики сегментов
+func (s *Sharded) Stats() Stats {
+	var total Stats
+	for _, shard := range s.shards {
+		stats := shard.Stats()
+		total.Hits += stats.Hits
+		total.Misses += stats.Misses
+		total.Evictions += stats.Evictions
+		total.Expirations += stats.Expirations
+		total.Entries += stats.Entries
+		total.Bytes += stats.Bytes
+	}
+	return total
+}
+
+// WriteSnapshot записывает записи всех сегментов в один снимок
+func (s *Sharded) WriteSnapshot(w io.Writer, watermark time.Time) (SnapshotInfo, error) {
+	var entries []snapshotEntry
+	for _, shard := range s.shards {
+		entries = append(entries, shard.snapshotEntries()...)
+	}
+	return writeSnapshot(w, watermark, entries)
+}
+
+// LoadSnapshot раскладывает записи снимка по сегментам. Снимок совместим
+// с Cache и с Sharded любого размера.
+func (s *Sharded) LoadSnapshot(r io.Reader) (SnapshotInfo, error) {
+	return loadSnapshot(r, func(order *models.Order, ttl time.Duration, expiresAt time.Time) {
+		s.shard(order.OrderUID).restore(order, ttl, expiresAt)
+	})
+}
+
+func (s *Sharded) SaveSnapshotFile(path string, watermark time.Time) (SnapshotInfo, error) {
+	return saveSnapshotFile(path, watermark, s.WriteSnapshot)
+}
+
+func (s *Sharded) LoadSnapshotFile(path string) (SnapshotInfo, error) {
+	return loadSnapshotFile(path, s.LoadSnapshot)
+}
+
+// Close останавливает фоновое удаление истекших записей
+func (s *Sharded) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// janitor обходит сегменты по очереди, каждый удаляет истекшие записи порциями
+func (s *Sharded) janitor() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(s.shards[0].janitorInterval()):
+			s.RemoveExpired()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package cache_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"wb-orders-service/cache"
+)
+
+func TestShardedConcurrentCopies(t *testing.T) {
+	t.Parallel()
+
+	store := cache.NewSharded(cache.Options{Shards: 4, MaxEntries: raceOrders})
+	defer store.Close()
+	testConcurrentCopies(t, store)
+}
+
+func TestShardedWarmSkipsFullShard(t *testing.T) {
+	t.Parallel()
+
+	// По одному заказу на сегмент: заполненный сегмент не останавливает прогрев
+	const shards = 4
+	store := cache.NewSharded(cache.Options{Shards: shards, MaxEntries: shards})
+	defer store.Close()
+
+	var added, skipped int
+	for i := 0; ; i++ {
+		if i > 1000 {
+			t.Fatalf("Warm did not report WarmFull, %d added, %d skipped", added, skipped)
+		}
+		switch store.Warm(version(i, 0), time.Minute) {
+		case cache.WarmAdded:
+			added++
+			continue
+		case cache.WarmSkipped:
+			skipped++
+			continue
+		}
+		break
+	}
+
+	if added != shards {
+		t.Errorf("added %d orders, want %d", added, shards)
+	}
+	if skipped == 0 {
+		t.Error("no orders skipped before all shards were full")
+	}
+	if store.Size() != shards {
+		t.Errorf("Size = %d, want %d", store.Size(), shards)
+	}
+}
+
+func BenchmarkCacheSharded(b *testing.B) {
+	for _, shards := range []int{4, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			benchmarkMixed(b, func() cache.Store { return cache.NewSharded(cache.Options{Shards: shards}) })
+		})
+	}
+}
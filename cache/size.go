@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"unsafe"
+	"wb-orders-service/models"
+)
+
+// Накладные расходы на запись: элемент списка, ключ и ячейка map
+const entryOverhead = 128
+
+// estimateSize оценивает объем памяти, занимаемый заказом в кэше
+func estimateSize(order *models.Order) int64 {
+	size := int64(unsafe.Sizeof(*order)) + entryOverhead
+	size += int64(len(order.OrderUID) + len(order.TrackNumber) + len(order.Entry) +
+		len(order.Locale) + len(order.InternalSignature) + len(order.CustomerID) +
+		len(order.DeliveryService) + len(order.Shardkey) + len(order.OofShard))
+
+	d := &order.Delivery
+	size += int64(len(d.OrderUID) + len(d.Name) + len(d.Phone) + len(d.Zip) +
+		len(d.City) + len(d.Address) + len(d.Region) + len(d.Email))
+
+	p := &order.Payment
+	size += int64(len(p.Transaction) + len(p.RequestID) + len(p.Currency) +
+		len(p.Provider) + len(p.Bank))
+
+	size += int64(cap(order.Items)) * int64(unsafe.Sizeof(models.Item{}))
+	for i := range order.Items {
+		item := &order.Items[i]
+		size += int64(len(item.OrderUID) + len(item.TrackNumber) + len(item.Rid) +
+			len(item.Name) + len(item.Size) + len(item.Brand))
+	}
+
+	return size
+}
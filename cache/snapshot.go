@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"wb-orders-service/models"
+)
+
+// Формат файла снимка:
+//
+//	magic "WBOC" | version uint32 | crc32 uint32 | length uint64 | gob(snapshotData)
+//
+// Все числа big-endian, crc32 (IEEE) считается по gob-части.
+const (
+	snapshotMagic   = "WBOC"
+	snapshotVersion = 1
+	headerSize      = 4 + 4 + 4 + 8
+)
+
+var (
+	ErrSnapshotCorrupt = errors.New("cache snapshot is corrupt")
+	ErrSnapshotVersion = errors.New("unsupported cache snapshot version")
+)
+
+// SnapshotInfo описывает загруженный или записанный снимок
+type SnapshotInfo struct {
+	CreatedAt time.Time // когда снимок был сделан
+	Watermark time.Time // заказы, созданные в БД после этого момента, в снимок могли не попасть
+	Entries   int
+}
+
+type snapshotData struct {
+	CreatedAt time.Time
+	Watermark time.Time
+	Entries   []snapshotEntry // от давно использованных к недавним
+}
+
+type snapshotEntry struct {
+	Order     models.Order
+	TTL       time.Duration
+	ExpiresAt time.Time
+}
+
+// WriteSnapshot записывает содержимое кэша в w
+func (c *Cache) WriteSnapshot(w io.Writer, watermark time.Time) (SnapshotInfo, error) {
+	return writeSnapshot(w, watermark, c.snapshotEntries())
+}
+
+// snapshotEntries копирует записи от давно использованных к недавним.
+// Заказы в кэше не изменяются, поэтому срезы Items можно не копировать.
+func (c *Cache) snapshotEntries() []snapshotEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]snapshotEntry, 0, c.lru.Len())
+	for elem := c.lru.Back(); elem != nil; elem = elem.Prev() {
+		e := elem.Value.(*entry)
+		entries = append(entries, snapshotEntry{Order: *e.order, TTL: e.ttl, ExpiresAt: e.expiresAt})
+	}
+	return entries
+}
+
+func writeSnapshot(w io.Writer, watermark time.Time, entries []snapshotEntry) (SnapshotInfo, error) {
+	data := snapshotData{
+		CreatedAt: time.Now(),
+		Watermark: watermark,
+		Entries:   entries,
+	}
+
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(&data); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to encode cache snapshot: %v", err)
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, snapshotMagic)
+	binary.BigEndian.PutUint32(header[4:], snapshotVersion)
+	binary.BigEndian.PutUint32(header[8:], crc32.ChecksumIEEE(payload.Bytes()))
+	binary.BigEndian.PutUint64(header[12:], uint64(payload.Len()))
+
+	if _, err := w.Write(header); err != nil {
+		return SnapshotInfo{}, err
+	}
+	if _, err := w.Write(payload.Bytes()); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	return SnapshotInfo{CreatedAt: data.CreatedAt, Watermark: watermark, Entries: len(data.Entries)}, nil
+}
+
+// LoadSnapshot читает снимок из r и добавляет его записи в кэш. Снимок
+// проверяется целиком до изменения кэша: при ошибке кэш остается прежним.
+func (c *Cache) LoadSnapshot(r io.Reader) (SnapshotInfo, error) {
+	return loadSnapshot(r, c.restore)
+}
+
+func loadSnapshot(r io.Reader, restore func(*models.Order, time.Duration, time.Time)) (SnapshotInfo, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+	if string(header[:4]) != snapshotMagic {
+		return SnapshotInfo{}, fmt.Errorf("%w: bad magic", ErrSnapshotCorrupt)
+	}
+	if version := binary.BigEndian.Uint32(header[4:]); version != snapshotVersion {
+		return SnapshotInfo{}, fmt.Errorf("%w: %d", ErrSnapshotVersion, version)
+	}
+
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to read cache snapshot: %v", err)
+	}
+	if uint64(len(payload)) != binary.BigEndian.Uint64(header[12:]) {
+		return SnapshotInfo{}, fmt.Errorf("%w: truncated", ErrSnapshotCorrupt)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[8:]) {
+		return SnapshotInfo{}, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+
+	var data snapshotData
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&data); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+
+	now := time.Now()
+	loaded := 0
+	for i := range data.Entries {
+		se := &data.Entries[i]
+		if !se.ExpiresAt.IsZero() && !se.ExpiresAt.After(now) {
+			continue
+		}
+		restore(&se.Order, se.TTL, se.ExpiresAt)
+		loaded++
+	}
+
+	return SnapshotInfo{CreatedAt: data.CreatedAt, Watermark: data.Watermark, Entries: loaded}, nil
+}
+
+// restore добавляет запись из снимка, сохраняя ее время истечения
+func (c *Cache) restore(order *models.Order, ttl time.Duration, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.data[order.OrderUID]; exists {
+		c.removeElement(elem)
+	}
+
+	e := &entry{order: order, size: estimateSize(order), ttl: ttl, expiresAt: expiresAt, index: -1}
+	if !expiresAt.IsZero() {
+		heap.Push(&c.expiry, e)
+	}
+	c.data[order.OrderUID] = c.lru.PushFront(e)
+	c.bytes += e.size
+	c.evict()
+}
+
+// SaveSnapshotFile атомарно записывает снимок в файл: сначала во временный, затем rename
+func (c *Cache) SaveSnapshotFile(path string, watermark time.Time) (SnapshotInfo, error) {
+	return saveSnapshotFile(path, watermark, c.WriteSnapshot)
+}
+
+// LoadSnapshotFile загружает снимок из файла
+func (c *Cache) LoadSnapshotFile(path string) (SnapshotInfo, error) {
+	return loadSnapshotFile(path, c.LoadSnapshot)
+}
+
+func saveSnapshotFile(path string, watermark time.Time, write func(io.Writer, time.Time) (SnapshotInfo, error)) (SnapshotInfo, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to create snapshot directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to create snapshot file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	info, err := write(tmp, watermark)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to write snapshot file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to replace snapshot file: %v", err)
+	}
+	return info, nil
+}
+
+func loadSnapshotFile(path string, load func(io.Reader) (SnapshotInfo, error)) (SnapshotInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	defer file.Close()
+
+	return load(bufio.NewReader(file))
+}
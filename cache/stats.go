@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"sync/atomic"
+)
+
+// Stats - счетчики работы кэша с момента запуска
+type Stats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+}
+
+type counters struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// Stats возвращает текущие счетчики и размер кэша
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	entries, bytes := len(c.data), c.bytes
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:        c.counters.hits.Load(),
+		Misses:      c.counters.misses.Load(),
+		Evictions:   c.counters.evictions.Load(),
+		Expirations: c.counters.expirations.Load(),
+		Entries:     entries,
+		Bytes:       bytes,
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"wb-orders-service/config"
+	"wb-orders-service/logging"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+const importUsage = "usage: main import [-batch-size N] [-rejects FILE] FILE... [config flags]"
+
+// runImport выполняет подкоманду import: загружает заказы из NDJSON-файлов
+// (заказ в формате сообщения NATS на строку, "-" - stdin) пачками по
+// -batch-size заказов в транзакции. Заказы, которые не разобраны, не прошли
+// проверку validation.* или отклонены хранилищем, пишутся в отчет -rejects.
+//
+//	main import orders.ndjson
+//	main import -rejects rejects.ndjson 2023-*.ndjson -db-host db
+func runImport(args []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" import", flag.ExitOnError)
+	batchSize := fs.Int("batch-size", 1000, "заказов в одной транзакции")
+	rejectsPath := fs.String("rejects", "", "файл отчета об отклоненных заказах (NDJSON), пусто - в лог")
+	fs.Parse(args)
+
+	// Файлы идут до флагов конфигурации
+	var files []string
+	args = fs.Args()
+	for len(args) > 0 && (args[0] == "-" || !strings.HasPrefix(args[0], "-")) {
+		files, args = append(files, args[0]), args[1:]
+	}
+	if len(files) == 0 || *batchSize < 1 {
+		log.Fatal(importUsage)
+	}
+
+	cfg, err := config.LoadArgs(os.Args[0]+" import", args)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if err := logging.SetLevel(cfg.Log.Level); err != nil {
+		log.Fatalf("Failed to set log level: %v", err)
+	}
+
+	// Ctrl+C прерывает импорт, уже записанные пачки остаются
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	repo, err := repository.NewPostgresRepository(ctx, cfg.Database.DSN(), connectOptions(cfg))
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer repo.Close()
+	repo.SetTimeouts(repoTimeouts(cfg))
+
+	imp := &importer{
+		repo:      repo,
+		rules:     validationRules(cfg),
+		batchSize: *batchSize,
+	}
+	if *rejectsPath != "" {
+		file, err := os.Create(*rejectsPath)
+		if err != nil {
+			log.Fatalf("Failed to create rejects report: %v", err)
+		}
+		defer file.Close()
+		imp.report = json.NewEncoder(file)
+	}
+
+	for _, path := range files {
+		if err = imp.importFile(ctx, path); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = imp.flush(ctx)
+	}
+	log.Printf("Import: %d lines, %d inserted, %d duplicates, %d rejected",
+		imp.lines, imp.inserted, imp.duplicates, imp.rejected)
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+}
+
+// importLine - заказ из файла, ожидающий записи
+type importLine struct {
+	file string
+	line int
+}
+
+// importRejection - строка отчета об отклоненном заказе
+type importRejection struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	OrderUID string `json:"order_uid,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+type importer struct {
+	repo      repository.OrderRepository
+	rules     models.ValidationRules
+	batchSize int
+	report    *json.Encoder // nil - отклоненные заказы пишутся в лог
+
+	batch   []repository.BatchOrder
+	sources []importLine // откуда взят заказ batch[i]
+
+	lines, inserted, duplicates, rejected int
+}
+
+// importFile читает заказы из файла, полные пачки записываются по ходу чтения
+func (imp *importer) importFile(ctx context.Context, path string) error {
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", path, err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	// ReadBytes не ограничивает длину строки, в отличие от bufio.Scanner
+	reader := bufio.NewReader(input)
+	for n := 1; ; n++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			imp.lines++
+			imp.add(importLine{file: path, line: n}, bytes.TrimSpace(data))
+			if len(imp.batch) >= imp.batchSize {
+				if err := imp.flush(ctx); err != nil {
+					return err
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+	}
+}
+
+// add разбирает и проверяет заказ так же, как подписчик NATS
+func (imp *importer) add(source importLine, message []byte) {
+	var order models.Order
+	if err := json.Unmarshal(message, &order); err != nil {
+		imp.reject(source, "", fmt.Sprintf("invalid JSON: %v", err))
+		return
+	}
+	if err := order.Validate(imp.rules); err != nil {
+		imp.reject(source, order.OrderUID, err.Error())
+		return
+	}
+	imp.batch = append(imp.batch, repository.BatchOrder{Order: &order, Message: message})
+	imp.sources = append(imp.sources, source)
+}
+
+// flush записывает накопленную пачку одной транзакцией
+func (imp *importer) flush(ctx context.Context) error {
+	if len(imp.batch) == 0 {
+		return nil
+	}
+
+	result, err := imp.repo.SaveOrdersBatch(ctx, imp.batch, repository.BatchOptions{Source: repository.ImportSource})
+	if err != nil {
+		first := imp.sources[0]
+		return fmt.Errorf("failed to save batch from %s:%d: %v", first.file, first.line, err)
+	}
+	imp.inserted += result.Inserted
+	imp.duplicates += result.Duplicates
+	for _, rejection := range result.Rejected {
+		imp.reject(imp.sources[rejection.Index], rejection.OrderUID, rejection.Err.Error())
+	}
+	logging.Infof("Imported batch of %d orders: %d inserted, %d duplicates, %d rejected",
+		len(imp.batch), result.Inserted, result.Duplicates, len(result.Rejected))
+
+	imp.batch = imp.batch[:0]
+	imp.sources = imp.sources[:0]
+	return nil
+}
+
+func (imp *importer) reject(source importLine, orderUID, reason string) {
+	imp.rejected++
+	if imp.report == nil {
+		logging.Warnf("%s:%d: order %q rejected: %s", source.file, source.line, orderUID, reason)
+		return
+	}
+	err := imp.report.Encode(importRejection{
+		File:     source.file,
+		Line:     source.line,
+		OrderUID: orderUID,
+		Reason:   reason,
+	})
+	if err != nil {
+		log.Fatalf("Failed to write rejects report: %v", err)
+	}
+}
@@ -1,46 +1,75 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 	"wb-orders-service/config"
 	"wb-orders-service/httpserver"
+	"wb-orders-service/logging"
 	"wb-orders-service/nats"
+	"wb-orders-service/outbox"
 	"wb-orders-service/repository"
 	"wb-orders-service/service"
 )
 
+// Сколько HTTP сервер ждет завершения начатых запросов при остановке
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	// Загружаем конфигурацию
-	cfg := config.Load()
+	// Подкоманды migrate, rederive и import работают с БД и завершаются
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rederive" {
+		runRederive(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
 
-	// Подключаемся к БД
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.DBName, cfg.Database.SSLMode)
+	// Загружаем конфигурацию
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if err := logging.SetLevel(cfg.Log.Level); err != nil {
+		log.Fatalf("Failed to set log level: %v", err)
+	}
+	reloader := config.NewReloader(cfg, config.Load)
 
-	repo, err := repository.NewPostgresRepository(connStr)
+	// Подключаемся к БД; если она еще не поднялась, ждем до database.connect_timeout
+	repo, err := repository.NewPostgresRepository(context.Background(), cfg.Database.DSN(), connectOptions(cfg))
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer repo.Close()
+	repo.SetTimeouts(repoTimeouts(cfg))
 
 	log.Println("Successfully connected to database")
 
-	// Создаем сервис (автоматически восстанавливает кэш из БД)
-	orderService := service.NewOrderService(repo)
-
-	// Инициализируем БД (создаем таблицы если нужно)
-	if err := repo.InitDB(); err != nil {
-    	log.Printf("Warning: failed to initialize database tables: %v", err)
+	// Применяем миграции схемы до прогрева кэша. Одновременно стартующие
+	// экземпляры применяют их по очереди под advisory lock.
+	if cfg.Database.MigrateOnStart {
+		if err := repo.InitDB(context.Background()); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
 	} else {
-    	log.Println("Database tables initialized successfully")
+		log.Println("Schema migrations on start are disabled, run: main migrate up")
 	}
-	
-	log.Printf("Service started with %d orders in cache", orderService.GetCacheSize())
+
+	// Создаем сервис (кэш прогревается в фоне из снимка или БД)
+	orderService := service.NewOrderService(repo, serviceOptions(cfg))
+	defer orderService.Close()
+
+	log.Println("Service started, cache warm-up is running in background")
 
 	// Создаем и настраиваем NATS подписчика
 	subscriber := nats.NewSubscriber(
@@ -50,6 +79,8 @@ func main() {
 		cfg.NATS.Subject,
 		orderService,
 	)
+	subscriber.SetValidationRules(validationRules(cfg))
+	subscriber.SetSavePolicy(savePolicy(cfg))
 
 	// Подключаемся к NATS
 	if err := subscriber.Connect(); err != nil {
@@ -66,8 +97,31 @@ func main() {
 
 	log.Println("NATS subscriber started successfully")
 
+	// Публикуем события о заказах из outbox через то же соединение с NATS
+	var relay *outbox.Relay
+	if cfg.Outbox.Enabled {
+		relay = outbox.NewRelay(repo, subscriber, outboxOptions(cfg))
+		defer relay.Close()
+	}
+
 	// Создаем HTTP роутер
-	router := httpserver.NewRouter(orderService)
+	router := httpserver.NewRouter(orderService, httpSettings(cfg), reloader)
+
+	// Применяем настройки, которые можно менять без перезапуска
+	reloader.OnReload(func(cfg *config.Config) {
+		if err := logging.SetLevel(cfg.Log.Level); err != nil {
+			log.Printf("Warning: failed to set log level: %v", err)
+		}
+		subscriber.SetValidationRules(validationRules(cfg))
+		subscriber.SetSavePolicy(savePolicy(cfg))
+		repo.SetTimeouts(repoTimeouts(cfg))
+		repo.SetPool(poolOptions(cfg))
+		orderService.SetOptions(serviceOptions(cfg))
+		if relay != nil {
+			relay.SetOptions(outboxOptions(cfg))
+		}
+		router.Apply(httpSettings(cfg))
+	})
 
 	// Запускаем HTTP сервер
 	server := &http.Server{
@@ -82,15 +136,31 @@ func main() {
 		}
 	}()
 
-	// Ожидаем сигналов завершения
+	// Ожидаем сигналов завершения, SIGHUP перечитывает конфигурацию
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
 	log.Println("Service is running. Press Ctrl+C to stop.")
 	log.Printf("Web interface: http://localhost:%s", cfg.HTTP.Port)
 	log.Printf("Health check: http://localhost:%s/health", cfg.HTTP.Port)
+	log.Printf("Readiness: http://localhost:%s/ready", cfg.HTTP.Port)
 	log.Printf("Get order: http://localhost:%s/order/{id}", cfg.HTTP.Port)
+	log.Printf("Cache stats: http://localhost:%s/cache/stats", cfg.HTTP.Port)
 
-	<-sigChan
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		log.Println("Received SIGHUP, reloading config...")
+		// Ошибки и изменения логирует сам Reloader
+		reloader.Reload()
+	}
 	log.Println("Shutting down service...")
+
+	// Дожидаемся начатых запросов до закрытия сервиса и БД
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Warning: HTTP server shutdown: %v", err)
+	}
 }
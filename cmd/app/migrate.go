@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+	"wb-orders-service/config"
+	"wb-orders-service/logging"
+	"wb-orders-service/repository"
+)
+
+const migrateUsage = "usage: main migrate up|down|status|to VERSION [config flags]"
+
+// runMigrate выполняет подкоманду migrate:
+//
+//	main migrate up        - применить все миграции
+//	main migrate down      - откатить последнюю миграцию
+//	main migrate status    - показать примененные версии
+//	main migrate to N      - привести схему к версии N (0 - откатить все)
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+	action, args := args[0], args[1:]
+
+	target := 0
+	switch action {
+	case "up", "down", "status":
+	case "to":
+		if len(args) == 0 {
+			log.Fatal(migrateUsage)
+		}
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < 0 {
+			log.Fatalf("Bad schema version %q", args[0])
+		}
+		target, args = version, args[1:]
+	default:
+		log.Fatal(migrateUsage)
+	}
+
+	cfg, err := config.LoadArgs(os.Args[0]+" migrate "+action, args)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if err := logging.SetLevel(cfg.Log.Level); err != nil {
+		log.Fatalf("Failed to set log level: %v", err)
+	}
+
+	// Ctrl+C прерывает ожидание БД и блокировки и текущую миграцию (она откатывается)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	repo, err := repository.NewPostgresRepository(ctx, cfg.Database.DSN(), connectOptions(cfg))
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer repo.Close()
+
+	switch action {
+	case "up":
+		err = repo.Migrate(ctx)
+	case "down":
+		err = repo.MigrateDown(ctx)
+	case "to":
+		err = repo.MigrateTo(ctx, target)
+	case "status":
+		err = printMigrationStatus(ctx, repo)
+	}
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+func printMigrationStatus(ctx context.Context, repo *repository.PostgresRepository) error {
+	status, err := repo.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range status {
+		name, appliedAt := s.Name, "pending"
+		if name == "" {
+			name = "(unknown to this build)"
+		}
+		if s.Applied {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, name, appliedAt)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"wb-orders-service/config"
+	"wb-orders-service/logging"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+const rederiveUsage = "usage: main rederive check|apply [config flags]"
+
+// runRederive выполняет подкоманду rederive: заново разбирает сохраненные
+// исходные сообщения (raw_orders) текущей моделью заказа.
+//
+//	main rederive check    - посчитать заказы, которые изменятся
+//	main rederive apply    - записать их как новые версии
+func runRederive(args []string) {
+	if len(args) == 0 || (args[0] != "check" && args[0] != "apply") {
+		log.Fatal(rederiveUsage)
+	}
+	action, args := args[0], args[1:]
+
+	cfg, err := config.LoadArgs(os.Args[0]+" rederive "+action, args)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if err := logging.SetLevel(cfg.Log.Level); err != nil {
+		log.Fatalf("Failed to set log level: %v", err)
+	}
+
+	// Ctrl+C прерывает пересборку, уже записанные заказы остаются
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	repo, err := repository.NewPostgresRepository(ctx, cfg.Database.DSN(), connectOptions(cfg))
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer repo.Close()
+	repo.SetTimeouts(repoTimeouts(cfg))
+
+	rules := validationRules(cfg)
+	stats, err := repository.Rederive(ctx, repo, repository.RederiveOptions{
+		DryRun: action == "check",
+		Validate: func(order *models.Order) error {
+			return order.Validate(rules)
+		},
+	})
+	log.Printf("Rederive %s: %d raw orders, %d changed, %d unchanged, %d archived, %d invalid",
+		action, stats.Total, stats.Changed, stats.Unchanged, stats.Archived, stats.Invalid)
+	if err != nil {
+		log.Fatalf("Rederive failed: %v", err)
+	}
+}
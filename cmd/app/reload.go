@@ -0,0 +1,108 @@
+package main
+
+import (
+	"wb-orders-service/cache"
+	"wb-orders-service/config"
+	"wb-orders-service/httpserver"
+	"wb-orders-service/models"
+	"wb-orders-service/outbox"
+	"wb-orders-service/repository"
+	"wb-orders-service/service"
+)
+
+// serviceOptions выбирает из конфигурации настройки сервиса заказов
+func serviceOptions(cfg *config.Config) service.Options {
+	return service.Options{
+		Cache:       cacheOptions(cfg),
+		OldOrderAge: cfg.Cache.OldOrderAge,
+		OldOrderTTL: cfg.Cache.OldOrderTTL,
+
+		NegativeMaxEntries: cfg.Cache.NegativeMaxEntries,
+		NegativeTTL:        cfg.Cache.NegativeTTL,
+
+		SnapshotPath:     cfg.Cache.SnapshotPath,
+		SnapshotInterval: cfg.Cache.SnapshotInterval,
+		SnapshotMaxAge:   cfg.Cache.SnapshotMaxAge,
+
+		WarmupReadyRatio: cfg.Cache.WarmupReadyRatio,
+	}
+}
+
+// cacheOptions выбирает из конфигурации ограничения и время жизни записей кэша
+func cacheOptions(cfg *config.Config) cache.Options {
+	return cache.Options{
+		MaxEntries:      cfg.Cache.MaxEntries,
+		MaxBytes:        cfg.Cache.MaxBytes,
+		Shards:          cfg.Cache.Shards,
+		TTL:             cfg.Cache.TTL,
+		Sliding:         cfg.Cache.SlidingTTL,
+		JanitorInterval: cfg.Cache.JanitorInterval,
+	}
+}
+
+// httpSettings выбирает из конфигурации параметры HTTP слоя
+func httpSettings(cfg *config.Config) httpserver.Settings {
+	return httpserver.Settings{
+		CORSOrigins: cfg.HTTP.CORSOrigins,
+		RateLimit:   cfg.HTTP.RateLimit,
+		RateBurst:   cfg.HTTP.RateBurst,
+		AdminToken:  cfg.HTTP.AdminToken,
+	}
+}
+
+// repoTimeouts выбирает из конфигурации дедлайны операций с БД
+func repoTimeouts(cfg *config.Config) repository.Timeouts {
+	return repository.Timeouts{
+		Read:   cfg.Database.ReadTimeout,
+		Write:  cfg.Database.WriteTimeout,
+		Stream: cfg.Database.StreamTimeout,
+	}
+}
+
+// connectOptions выбирает из конфигурации параметры подключения к БД
+func connectOptions(cfg *config.Config) repository.ConnectOptions {
+	return repository.ConnectOptions{
+		Pool:         poolOptions(cfg),
+		RetryTimeout: cfg.Database.ConnectTimeout,
+	}
+}
+
+// poolOptions выбирает из конфигурации настройки пула соединений
+func poolOptions(cfg *config.Config) repository.PoolOptions {
+	return repository.PoolOptions{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.Database.ConnMaxIdleTime,
+	}
+}
+
+// savePolicy выбирает из конфигурации политику сохранения заказов из NATS.
+// Значение уже проверено при загрузке конфигурации.
+func savePolicy(cfg *config.Config) repository.SavePolicy {
+	policy, _ := repository.ParseSavePolicy(cfg.NATS.SavePolicy)
+	return policy
+}
+
+// validationRules выбирает из конфигурации правила проверки заказов
+func validationRules(cfg *config.Config) models.ValidationRules {
+	return models.ValidationRules{
+		RequireTrackNumber: cfg.Validation.RequireTrackNumber,
+		RequireEntry:       cfg.Validation.RequireEntry,
+		MaxItems:           cfg.Validation.MaxItems,
+		Currencies:         cfg.Validation.Currencies,
+	}
+}
+
+// outboxOptions выбирает из конфигурации настройки публикации событий о заказах
+func outboxOptions(cfg *config.Config) outbox.Options {
+	return outbox.Options{
+		Subject:      cfg.Outbox.Subject,
+		PollInterval: cfg.Outbox.PollInterval,
+		BatchSize:    cfg.Outbox.BatchSize,
+		Lease:        cfg.Outbox.Lease,
+		RetryMin:     cfg.Outbox.RetryMin,
+		RetryMax:     cfg.Outbox.RetryMax,
+		Retention:    cfg.Outbox.Retention,
+	}
+}
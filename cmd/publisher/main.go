@@ -5,20 +5,24 @@ import (
 	"fmt"
 	"log"
 	"time"
+	"wb-orders-service/config"
 	"wb-orders-service/models"
 
 	"github.com/nats-io/stan.go"
 )
 
 func main() {
-	// Конфигурация NATS
-	clusterID := "test-cluster"
-	clientID := "test-publisher"
-	url := "nats://localhost:4222"
-	subject := "orders"
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// ID клиента должен отличаться от ID сервиса, иначе NATS Streaming отклонит подключение
+	clientID := cfg.NATS.ClientID + "-publisher"
+	subject := cfg.NATS.Subject
 
 	// Подключаемся к NATS
-	sc, err := stan.Connect(clusterID, clientID, stan.NatsURL(url))
+	sc, err := stan.Connect(cfg.NATS.ClusterID, clientID, stan.NatsURL(cfg.NATS.URL))
 	if err != nil {
 		log.Fatalf("Failed to connect to NATS: %v", err)
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -11,12 +12,13 @@ import (
 )
 
 func main() {
-	cfg := config.Load()
-
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.DBName, cfg.Database.SSLMode)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 
-	repo, err := repository.NewPostgresRepository(connStr)
+	ctx := context.Background()
+	repo, err := repository.NewPostgresRepository(ctx, cfg.Database.DSN(), repository.ConnectOptions{RetryTimeout: cfg.Database.ConnectTimeout})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -73,16 +75,17 @@ func main() {
 		},
 	}
 
-	// Тестируем сохранение
+	// Тестируем сохранение; при повторном запуске заказ заменяется
 	fmt.Println("Saving test order...")
-	err = repo.SaveOrder(testOrder)
+	result, err := repo.SaveOrder(ctx, testOrder, repository.SaveOptions{Policy: repository.SaveReplace})
 	if err != nil {
 		log.Fatalf("Failed to save order: %v", err)
 	}
+	fmt.Printf("Save result: %s\n", result)
 
 	// Тестируем чтение
 	fmt.Println("Reading test order...")
-	readOrder, err := repo.GetOrderByUID("test-order-123")
+	readOrder, err := repo.GetOrderByUID(ctx, "test-order-123", repository.ReadOptions{})
 	if err != nil {
 		log.Fatalf("Failed to read order: %v", err)
 	}
@@ -93,7 +96,7 @@ func main() {
 
 	// Тестируем получение всех заказов
 	fmt.Println("Getting all orders...")
-	allOrders, err := repo.GetAllOrders()
+	allOrders, err := repo.GetAllOrders(ctx)
 	if err != nil {
 		log.Fatalf("Failed to get all orders: %v", err)
 	}
@@ -1,32 +1,129 @@
 package config
 
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wb-orders-service/logging"
+
+	"gopkg.in/yaml.v3"
+)
+
 type Config struct {
-	Database DatabaseConfig
-	NATS     NATSConfig
-	HTTP     HTTPConfig
+	Database   DatabaseConfig   `yaml:"database"`
+	NATS       NATSConfig       `yaml:"nats"`
+	HTTP       HTTPConfig       `yaml:"http"`
+	Cache      CacheConfig      `yaml:"cache"`
+	Log        LogConfig        `yaml:"log"`
+	Validation ValidationConfig `yaml:"validation"`
+	Outbox     OutboxConfig     `yaml:"outbox"`
 }
 
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	DBName   string `yaml:"dbname"`
+	SSLMode  string `yaml:"sslmode"`
+
+	MigrateOnStart bool `yaml:"migrate_on_start"` // применять миграции схемы при старте
+
+	// Дедлайны операций с БД, 0 - без ограничения
+	ReadTimeout   time.Duration `yaml:"read_timeout"`
+	WriteTimeout  time.Duration `yaml:"write_timeout"`
+	StreamTimeout time.Duration `yaml:"stream_timeout"` // на одну пачку при чтении всех заказов
+
+	// Пул соединений
+	MaxOpenConns    int           `yaml:"max_open_conns"`     // 0 - без ограничения
+	MaxIdleConns    int           `yaml:"max_idle_conns"`     // 0 - не держать простаивающие
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`  // 0 - без ограничения
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"` // 0 - без ограничения
+
+	// Сколько ждать БД при старте, повторяя попытки подключения
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
 }
 
 type NATSConfig struct {
-	ClusterID string
-	ClientID  string
-	URL       string
-	Subject   string
+	ClusterID string `yaml:"cluster_id"`
+	ClientID  string `yaml:"client_id"`
+	URL       string `yaml:"url"`
+	Subject   string `yaml:"subject"`
+
+	SavePolicy string `yaml:"save_policy"` // reject, skip, replace или update для заказа с занятым order_uid
 }
 
 type HTTPConfig struct {
-	Port string
+	Port        string   `yaml:"port"`
+	CORSOrigins []string `yaml:"cors_origins"`
+	RateLimit   float64  `yaml:"rate_limit"` // запросов в секунду, 0 - без ограничения
+	RateBurst   int      `yaml:"rate_burst"`
+	AdminToken  string   `yaml:"admin_token"` // пусто - admin API отключен
+}
+
+// CacheConfig - ограничения кэша заказов, 0 - без ограничения
+type CacheConfig struct {
+	MaxEntries      int           `yaml:"max_entries"`
+	MaxBytes        int64         `yaml:"max_bytes"`
+	Shards          int           `yaml:"shards"`
+	TTL             time.Duration `yaml:"ttl"`
+	SlidingTTL      bool          `yaml:"sliding_ttl"`
+	JanitorInterval time.Duration `yaml:"janitor_interval"`
+	OldOrderAge     time.Duration `yaml:"old_order_age"`
+	OldOrderTTL     time.Duration `yaml:"old_order_ttl"`
+
+	NegativeMaxEntries int           `yaml:"negative_max_entries"`
+	NegativeTTL        time.Duration `yaml:"negative_ttl"` // 0 - не кэшировать отсутствующие заказы
+
+	SnapshotPath     string        `yaml:"snapshot_path"` // пусто - снимки отключены
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+	SnapshotMaxAge   time.Duration `yaml:"snapshot_max_age"`
+
+	WarmupReadyRatio float64 `yaml:"warmup_ready_ratio"` // доля прогретых заказов для готовности
 }
 
-func Load() *Config {
+type LogConfig struct {
+	Level string `yaml:"level"`
+}
+
+// ValidationConfig - правила проверки входящих заказов
+type ValidationConfig struct {
+	RequireTrackNumber bool     `yaml:"require_track_number"`
+	RequireEntry       bool     `yaml:"require_entry"`
+	MaxItems           int      `yaml:"max_items"`
+	Currencies         []string `yaml:"currencies"`
+}
+
+// OutboxConfig - публикация событий о заказах из outbox в NATS
+type OutboxConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Subject      string        `yaml:"subject"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`
+	Lease        time.Duration `yaml:"lease"` // сколько событие зарезервировано за экземпляром
+	RetryMin     time.Duration `yaml:"retry_min"`
+	RetryMax     time.Duration `yaml:"retry_max"`
+	Retention    time.Duration `yaml:"retention"` // 0 - не удалять отправленные события
+}
+
+// ValidationError перечисляет все проблемы, найденные при загрузке конфигурации
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Default возвращает конфигурацию по умолчанию (локальный запуск без docker)
+func Default() *Config {
 	return &Config{
 		Database: DatabaseConfig{
 			Host:     "localhost",
@@ -35,15 +132,272 @@ func Load() *Config {
 			Password: "wbpassword",
 			DBName:   "wb_orders",
 			SSLMode:  "disable",
+
+			MigrateOnStart: true,
+
+			ReadTimeout:   5 * time.Second,
+			WriteTimeout:  10 * time.Second,
+			StreamTimeout: 30 * time.Second,
+
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+
+			ConnectTimeout: time.Minute,
 		},
 		NATS: NATSConfig{
 			ClusterID: "test-cluster",
 			ClientID:  "wb-orders-service",
 			URL:       "nats://localhost:4222",
 			Subject:   "orders",
+
+			SavePolicy: "update",
 		},
 		HTTP: HTTPConfig{
-			Port: "8080",
+			Port:        "8080",
+			CORSOrigins: []string{"*"},
+			RateBurst:   50,
+		},
+		Cache: CacheConfig{
+			MaxEntries:      100000,
+			MaxBytes:        256 << 20,
+			Shards:          1,
+			JanitorInterval: time.Minute,
+
+			NegativeMaxEntries: 10000,
+			NegativeTTL:        30 * time.Second,
+
+			SnapshotInterval: 5 * time.Minute,
+			SnapshotMaxAge:   24 * time.Hour,
+
+			WarmupReadyRatio: 1,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Validation: ValidationConfig{
+			RequireTrackNumber: true,
+			RequireEntry:       true,
 		},
+		Outbox: OutboxConfig{
+			Enabled:      true,
+			Subject:      "orders.events",
+			PollInterval: time.Second,
+			BatchSize:    100,
+			Lease:        30 * time.Second,
+			RetryMin:     time.Second,
+			RetryMax:     5 * time.Minute,
+			Retention:    7 * 24 * time.Hour,
+		},
+	}
+}
+
+// Load собирает конфигурацию из аргументов командной строки процесса
+func Load() (*Config, error) {
+	return LoadArgs(os.Args[0], os.Args[1:])
+}
+
+// LoadArgs собирает конфигурацию по слоям: значения по умолчанию, затем
+// YAML-файл (-config или CONFIG_FILE), затем переменные окружения, затем флаги.
+// Все ошибки разбора и валидации возвращаются одной ValidationError.
+func LoadArgs(name string, args []string) (*Config, error) {
+	cfg := Default()
+	fields := cfg.fields()
+
+	// Флаги разбираем первыми, чтобы узнать путь к файлу,
+	// но применяем последними - у них наивысший приоритет
+	flagValues := make(map[string]string)
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "путь к YAML-файлу конфигурации (CONFIG_FILE)")
+	for _, f := range fields {
+		fs.Var(newFlagValue(f, flagValues), f.flag, fmt.Sprintf("%s (%s)", f.usage, f.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	for _, f := range fields {
+		value, ok := os.LookupEnv(f.env)
+		if !ok {
+			continue
+		}
+		if err := setField(f.value, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%s): %v", f.key, f.env, err))
+		}
+	}
+
+	for _, f := range fields {
+		value, ok := flagValues[f.flag]
+		if !ok {
+			continue
+		}
+		if err := setField(f.value, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (-%s): %v", f.key, f.flag, err))
+		}
+	}
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	return cfg, nil
+}
+
+// loadFile накладывает значения из YAML-файла поверх текущих
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %v", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// validate возвращает список всех некорректных или пустых полей
+func (c *Config) validate() []string {
+	var problems []string
+	required := func(key, value string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, key+" is required")
+		}
+	}
+	port := func(key, value string) {
+		if value == "" {
+			problems = append(problems, key+" is required")
+			return
+		}
+		if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+			problems = append(problems, fmt.Sprintf("%s must be a port number, got %q", key, value))
+		}
+	}
+
+	required("database.host", c.Database.Host)
+	port("database.port", c.Database.Port)
+	required("database.user", c.Database.User)
+	required("database.dbname", c.Database.DBName)
+	switch c.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		problems = append(problems, fmt.Sprintf("database.sslmode has unsupported value %q", c.Database.SSLMode))
+	}
+	if c.Database.ReadTimeout < 0 || c.Database.WriteTimeout < 0 || c.Database.StreamTimeout < 0 {
+		problems = append(problems, "database timeouts must not be negative")
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ConnMaxLifetime < 0 || c.Database.ConnMaxIdleTime < 0 {
+		problems = append(problems, "database pool settings must not be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problems = append(problems, "database.max_idle_conns must not exceed database.max_open_conns")
+	}
+	if c.Database.ConnectTimeout < 0 {
+		problems = append(problems, "database.connect_timeout must not be negative")
+	}
+
+	required("nats.cluster_id", c.NATS.ClusterID)
+	required("nats.client_id", c.NATS.ClientID)
+	required("nats.subject", c.NATS.Subject)
+	if c.NATS.URL == "" {
+		problems = append(problems, "nats.url is required")
+	} else if u, err := url.Parse(c.NATS.URL); err != nil || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("nats.url must be a URL like nats://host:4222, got %q", c.NATS.URL))
+	}
+	switch c.NATS.SavePolicy {
+	case "reject", "skip", "replace", "update":
+	default:
+		problems = append(problems, fmt.Sprintf("nats.save_policy has unsupported value %q, want reject, skip, replace or update", c.NATS.SavePolicy))
+	}
+
+	port("http.port", c.HTTP.Port)
+	if c.HTTP.RateLimit < 0 {
+		problems = append(problems, "http.rate_limit must not be negative")
+	}
+	if c.HTTP.RateLimit > 0 && c.HTTP.RateBurst < 1 {
+		problems = append(problems, "http.rate_burst must be positive when http.rate_limit is set")
+	}
+
+	if c.Cache.MaxEntries < 0 {
+		problems = append(problems, "cache.max_entries must not be negative")
+	}
+	if c.Cache.Shards < 1 {
+		problems = append(problems, "cache.shards must be at least 1")
+	}
+	if c.Cache.MaxBytes < 0 {
+		problems = append(problems, "cache.max_bytes must not be negative")
+	}
+	if c.Cache.TTL < 0 || c.Cache.OldOrderAge < 0 || c.Cache.OldOrderTTL < 0 {
+		problems = append(problems, "cache TTL settings must not be negative")
+	}
+	if c.Cache.JanitorInterval <= 0 {
+		problems = append(problems, "cache.janitor_interval must be positive")
+	}
+	if c.Cache.NegativeMaxEntries < 0 || c.Cache.NegativeTTL < 0 {
+		problems = append(problems, "cache negative settings must not be negative")
+	}
+	if c.Cache.SnapshotInterval < 0 || c.Cache.SnapshotMaxAge < 0 {
+		problems = append(problems, "cache snapshot settings must not be negative")
+	}
+	if c.Cache.WarmupReadyRatio < 0 || c.Cache.WarmupReadyRatio > 1 {
+		problems = append(problems, "cache.warmup_ready_ratio must be between 0 and 1")
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		problems = append(problems, "log.level: "+err.Error())
+	}
+
+	if c.Validation.MaxItems < 0 {
+		problems = append(problems, "validation.max_items must not be negative")
+	}
+
+	if c.Outbox.Enabled {
+		required("outbox.subject", c.Outbox.Subject)
+		if c.Outbox.Subject == c.NATS.Subject {
+			problems = append(problems, "outbox.subject must differ from nats.subject")
+		}
+	}
+	if c.Outbox.PollInterval <= 0 || c.Outbox.Lease <= 0 {
+		problems = append(problems, "outbox.poll_interval and outbox.lease must be positive")
+	}
+	if c.Outbox.BatchSize < 1 {
+		problems = append(problems, "outbox.batch_size must be at least 1")
+	}
+	if c.Outbox.RetryMin <= 0 || c.Outbox.RetryMax < c.Outbox.RetryMin {
+		problems = append(problems, "outbox.retry_min must be positive and not exceed outbox.retry_max")
+	}
+	if c.Outbox.Retention < 0 {
+		problems = append(problems, "outbox.retention must not be negative")
+	}
+
+	return problems
+}
+
+// DSN возвращает строку подключения к PostgreSQL в формате key=value
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		quoteDSN(d.Host), quoteDSN(d.Port), quoteDSN(d.User), quoteDSN(d.Password), quoteDSN(d.DBName), quoteDSN(d.SSLMode))
+}
+
+// quoteDSN экранирует значение, если в нем есть пробелы или кавычки
+func quoteDSN(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
 	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
 }
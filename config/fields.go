@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Признаки полей конфигурации
+const (
+	restart = 1 << iota // изменение требует перезапуска сервиса
+	secret              // значение не выводится в логи
+)
+
+// field связывает поле Config с переменной окружения и флагом командной строки
+type field struct {
+	key   string // путь к полю в файле конфигурации
+	env   string
+	flag  string
+	usage string
+	value any // указатель на поле Config
+	attrs int
+}
+
+func (c *Config) fields() []field {
+	return []field{
+		{"database.host", "DB_HOST", "db-host", "адрес PostgreSQL", &c.Database.Host, restart},
+		{"database.port", "DB_PORT", "db-port", "порт PostgreSQL", &c.Database.Port, restart},
+		{"database.user", "DB_USER", "db-user", "пользователь PostgreSQL", &c.Database.User, restart},
+		{"database.password", "DB_PASSWORD", "db-password", "пароль PostgreSQL", &c.Database.Password, restart | secret},
+		{"database.dbname", "DB_NAME", "db-name", "имя базы данных", &c.Database.DBName, restart},
+		{"database.sslmode", "DB_SSLMODE", "db-sslmode", "режим SSL для PostgreSQL", &c.Database.SSLMode, restart},
+		{"database.migrate_on_start", "DB_MIGRATE_ON_START", "db-migrate-on-start", "применять миграции схемы при старте", &c.Database.MigrateOnStart, restart},
+		{"database.read_timeout", "DB_READ_TIMEOUT", "db-read-timeout", "дедлайн чтения из БД, 0 - без ограничения", &c.Database.ReadTimeout, 0},
+		{"database.write_timeout", "DB_WRITE_TIMEOUT", "db-write-timeout", "дедлайн сохранения заказа в БД, 0 - без ограничения", &c.Database.WriteTimeout, 0},
+		{"database.stream_timeout", "DB_STREAM_TIMEOUT", "db-stream-timeout", "дедлайн загрузки одной пачки заказов, 0 - без ограничения", &c.Database.StreamTimeout, 0},
+		{"database.max_open_conns", "DB_MAX_OPEN_CONNS", "db-max-open-conns", "максимум открытых соединений, 0 - без ограничения", &c.Database.MaxOpenConns, 0},
+		{"database.max_idle_conns", "DB_MAX_IDLE_CONNS", "db-max-idle-conns", "максимум простаивающих соединений", &c.Database.MaxIdleConns, 0},
+		{"database.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "время жизни соединения, 0 - без ограничения", &c.Database.ConnMaxLifetime, 0},
+		{"database.conn_max_idle_time", "DB_CONN_MAX_IDLE_TIME", "db-conn-max-idle-time", "время простоя соединения до закрытия, 0 - без ограничения", &c.Database.ConnMaxIdleTime, 0},
+		{"database.connect_timeout", "DB_CONNECT_TIMEOUT", "db-connect-timeout", "сколько ждать БД при старте, 0 - одна попытка", &c.Database.ConnectTimeout, restart},
+		{"nats.cluster_id", "NATS_CLUSTER_ID", "nats-cluster-id", "ID кластера NATS Streaming", &c.NATS.ClusterID, restart},
+		{"nats.client_id", "NATS_CLIENT_ID", "nats-client-id", "ID клиента NATS Streaming", &c.NATS.ClientID, restart},
+		{"nats.url", "NATS_URL", "nats-url", "адрес NATS", &c.NATS.URL, restart},
+		{"nats.subject", "NATS_SUBJECT", "nats-subject", "канал с заказами", &c.NATS.Subject, restart},
+		{"nats.save_policy", "NATS_SAVE_POLICY", "nats-save-policy", "заказ с уже занятым order_uid: reject, skip, replace или update", &c.NATS.SavePolicy, 0},
+		{"http.port", "HTTP_PORT", "http-port", "порт HTTP сервера", &c.HTTP.Port, restart},
+		{"http.cors_origins", "HTTP_CORS_ORIGINS", "http-cors-origins", "разрешенные CORS origins через запятую", &c.HTTP.CORSOrigins, 0},
+		{"http.rate_limit", "HTTP_RATE_LIMIT", "http-rate-limit", "лимит запросов в секунду, 0 - без лимита", &c.HTTP.RateLimit, 0},
+		{"http.rate_burst", "HTTP_RATE_BURST", "http-rate-burst", "допустимый всплеск запросов сверх лимита", &c.HTTP.RateBurst, 0},
+		{"http.admin_token", "HTTP_ADMIN_TOKEN", "http-admin-token", "токен для admin API", &c.HTTP.AdminToken, secret},
+		{"cache.max_entries", "CACHE_MAX_ENTRIES", "cache-max-entries", "максимум заказов в кэше, 0 - без ограничения", &c.Cache.MaxEntries, 0},
+		{"cache.max_bytes", "CACHE_MAX_BYTES", "cache-max-bytes", "максимальный объем кэша в байтах, 0 - без ограничения", &c.Cache.MaxBytes, 0},
+		{"cache.shards", "CACHE_SHARDS", "cache-shards", "число независимо блокируемых сегментов кэша", &c.Cache.Shards, restart},
+		{"cache.ttl", "CACHE_TTL", "cache-ttl", "время жизни заказа в кэше, 0 - бессрочно", &c.Cache.TTL, 0},
+		{"cache.sliding_ttl", "CACHE_SLIDING_TTL", "cache-sliding-ttl", "продлевать время жизни при чтении", &c.Cache.SlidingTTL, 0},
+		{"cache.janitor_interval", "CACHE_JANITOR_INTERVAL", "cache-janitor-interval", "период удаления истекших записей", &c.Cache.JanitorInterval, 0},
+		{"cache.old_order_age", "CACHE_OLD_ORDER_AGE", "cache-old-order-age", "возраст, после которого заказ считается старым, 0 - не различать", &c.Cache.OldOrderAge, 0},
+		{"cache.old_order_ttl", "CACHE_OLD_ORDER_TTL", "cache-old-order-ttl", "время жизни старых заказов в кэше", &c.Cache.OldOrderTTL, 0},
+		{"cache.negative_max_entries", "CACHE_NEGATIVE_MAX_ENTRIES", "cache-negative-max-entries", "максимум запомненных отсутствующих order_uid", &c.Cache.NegativeMaxEntries, 0},
+		{"cache.negative_ttl", "CACHE_NEGATIVE_TTL", "cache-negative-ttl", "сколько помнить отсутствующий order_uid, 0 - не помнить", &c.Cache.NegativeTTL, 0},
+		{"cache.snapshot_path", "CACHE_SNAPSHOT_PATH", "cache-snapshot-path", "файл снимка кэша, пусто - снимки отключены", &c.Cache.SnapshotPath, restart},
+		{"cache.snapshot_interval", "CACHE_SNAPSHOT_INTERVAL", "cache-snapshot-interval", "период записи снимка кэша, 0 - только при остановке", &c.Cache.SnapshotInterval, restart},
+		{"cache.snapshot_max_age", "CACHE_SNAPSHOT_MAX_AGE", "cache-snapshot-max-age", "максимальный возраст снимка при старте", &c.Cache.SnapshotMaxAge, restart},
+		{"cache.warmup_ready_ratio", "CACHE_WARMUP_READY_RATIO", "cache-warmup-ready-ratio", "доля прогретых заказов, после которой сервис готов (0..1)", &c.Cache.WarmupReadyRatio, 0},
+		{"log.level", "LOG_LEVEL", "log-level", "уровень логов: debug, info, warn, error", &c.Log.Level, 0},
+		{"validation.require_track_number", "VALIDATION_REQUIRE_TRACK_NUMBER", "validation-require-track-number", "требовать track_number", &c.Validation.RequireTrackNumber, 0},
+		{"validation.require_entry", "VALIDATION_REQUIRE_ENTRY", "validation-require-entry", "требовать entry", &c.Validation.RequireEntry, 0},
+		{"validation.max_items", "VALIDATION_MAX_ITEMS", "validation-max-items", "максимум товаров в заказе, 0 - без ограничения", &c.Validation.MaxItems, 0},
+		{"validation.currencies", "VALIDATION_CURRENCIES", "validation-currencies", "разрешенные валюты через запятую", &c.Validation.Currencies, 0},
+		{"outbox.enabled", "OUTBOX_ENABLED", "outbox-enabled", "публиковать события о заказах в NATS", &c.Outbox.Enabled, restart},
+		{"outbox.subject", "OUTBOX_SUBJECT", "outbox-subject", "канал для событий о заказах", &c.Outbox.Subject, 0},
+		{"outbox.poll_interval", "OUTBOX_POLL_INTERVAL", "outbox-poll-interval", "пауза между опросами outbox", &c.Outbox.PollInterval, 0},
+		{"outbox.batch_size", "OUTBOX_BATCH_SIZE", "outbox-batch-size", "событий за один опрос", &c.Outbox.BatchSize, 0},
+		{"outbox.lease", "OUTBOX_LEASE", "outbox-lease", "на сколько событие резервируется за экземпляром", &c.Outbox.Lease, 0},
+		{"outbox.retry_min", "OUTBOX_RETRY_MIN", "outbox-retry-min", "пауза перед повтором публикации после первой ошибки", &c.Outbox.RetryMin, 0},
+		{"outbox.retry_max", "OUTBOX_RETRY_MAX", "outbox-retry-max", "предел паузы перед повтором публикации", &c.Outbox.RetryMax, 0},
+		{"outbox.retention", "OUTBOX_RETENTION", "outbox-retention", "сколько хранить отправленные события, 0 - всегда", &c.Outbox.Retention, 0},
+	}
+}
+
+// setField разбирает строковое значение в поле соответствующего типа
+func setField(ptr any, value string) error {
+	switch p := ptr.(type) {
+	case *string:
+		*p = value
+	case *int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*p = n
+	case *int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*p = n
+	case *float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*p = f
+	case *bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*p = b
+	case *time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*p = d
+	case *[]string:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*p = list
+	default:
+		return fmt.Errorf("unsupported field type %T", ptr)
+	}
+	return nil
+}
+
+// formatField возвращает значение поля в виде строки для логов и сравнения
+func formatField(f field) string {
+	var value string
+	switch p := f.value.(type) {
+	case *[]string:
+		value = strings.Join(*p, ",")
+	case *time.Duration:
+		value = p.String()
+	default:
+		value = fmt.Sprint(reflect.ValueOf(p).Elem().Interface())
+	}
+	if f.attrs&secret != 0 && value != "" {
+		return "***"
+	}
+	return value
+}
+
+// copyField копирует значение поля src в поле dst того же типа
+func copyField(dst, src any) {
+	reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(src).Elem())
+}
+
+// flagValue запоминает явно переданные флаги, чтобы применить их после файла и окружения
+type flagValue struct {
+	name   string
+	isBool bool
+	values map[string]string
+}
+
+func newFlagValue(f field, values map[string]string) flagValue {
+	_, isBool := f.value.(*bool)
+	return flagValue{name: f.flag, isBool: isBool, values: values}
+}
+
+func (v flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+func (v flagValue) String() string {
+	return ""
+}
+
+func (v flagValue) Set(value string) error {
+	v.values[v.name] = value
+	return nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+	"wb-orders-service/logging"
+)
+
+// Change описывает изменение одного поля конфигурации
+type Change struct {
+	Key             string `json:"key"`
+	Old             string `json:"old"`
+	New             string `json:"new"`
+	RestartRequired bool   `json:"restart_required"`
+}
+
+// ReloadResult - итог перезагрузки конфигурации
+type ReloadResult struct {
+	Applied         []Change `json:"applied"`
+	RestartRequired []Change `json:"restart_required"`
+}
+
+// Diff возвращает список полей, значения которых отличаются
+func Diff(old, new *Config) []Change {
+	oldFields, newFields := old.fields(), new.fields()
+
+	var changes []Change
+	for i := range oldFields {
+		if reflect.DeepEqual(reflect.ValueOf(oldFields[i].value).Elem().Interface(),
+			reflect.ValueOf(newFields[i].value).Elem().Interface()) {
+			continue
+		}
+		changes = append(changes, Change{
+			Key:             oldFields[i].key,
+			Old:             formatField(oldFields[i]),
+			New:             formatField(newFields[i]),
+			RestartRequired: oldFields[i].attrs&restart != 0,
+		})
+	}
+	return changes
+}
+
+// Reloader хранит действующую конфигурацию и применяет изменения,
+// которые безопасно менять без перезапуска
+type Reloader struct {
+	mu       sync.Mutex
+	current  *Config
+	load     func() (*Config, error)
+	handlers []func(*Config)
+}
+
+// NewReloader создает Reloader; load перечитывает конфигурацию (обычно config.Load)
+func NewReloader(cfg *Config, load func() (*Config, error)) *Reloader {
+	return &Reloader{
+		current: cfg,
+		load:    load,
+	}
+}
+
+// OnReload регистрирует обработчик, получающий новую конфигурацию после перезагрузки
+func (r *Reloader) OnReload(handler func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers = append(r.handlers, handler)
+}
+
+// Current возвращает действующую конфигурацию
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.current
+}
+
+// Reload перечитывает конфигурацию и применяет изменения. Поля, требующие
+// перезапуска, остаются прежними и возвращаются в RestartRequired.
+// Если новая конфигурация некорректна, ничего не применяется.
+func (r *Reloader) Reload() (*ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		logging.Errorf("Config reload failed: %v", err)
+		return nil, err
+	}
+
+	result := &ReloadResult{}
+	currentFields, nextFields := r.current.fields(), next.fields()
+	for _, change := range Diff(r.current, next) {
+		if !change.RestartRequired {
+			logging.Infof("Config reload: %s changed: %q -> %q", change.Key, change.Old, change.New)
+			result.Applied = append(result.Applied, change)
+			continue
+		}
+
+		logging.Warnf("Config reload: %s changed: %q -> %q, restart required, not applied", change.Key, change.Old, change.New)
+		result.RestartRequired = append(result.RestartRequired, change)
+		for i := range nextFields {
+			if nextFields[i].key == change.Key {
+				copyField(nextFields[i].value, currentFields[i].value)
+			}
+		}
+	}
+
+	if len(result.Applied) == 0 {
+		if len(result.RestartRequired) == 0 {
+			logging.Infof("Config reload: no changes")
+		}
+		return result, nil
+	}
+
+	r.current = next
+	for _, handler := range r.handlers {
+		handler(next)
+	}
+
+	return result, nil
+}
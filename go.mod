@@ -2,13 +2,17 @@ module wb-orders-service
 
 go 1.24.9
 
+require (
+	github.com/lib/pq v1.10.9
+	github.com/nats-io/stan.go v0.10.4
+	gopkg.in/yaml.v3 v3.0.1
+)
+
 require (
 	github.com/go-chi/chi/v5 v5.2.3 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
-	github.com/lib/pq v1.10.9 // indirect
 	github.com/nats-io/nats.go v1.22.1 // indirect
 	github.com/nats-io/nkeys v0.3.0 // indirect
 	github.com/nats-io/nuid v1.0.1 // indirect
-	github.com/nats-io/stan.go v0.10.4 // indirect
 	golang.org/x/crypto v0.5.0 // indirect
 )
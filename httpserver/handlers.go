@@ -1,28 +1,42 @@
 package httpserver
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"wb-orders-service/logging"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
 	"wb-orders-service/service"
 )
 
 type Handlers struct {
-	service *service.OrderService
+	service  *service.OrderService
+	reloader Reloader
+	settings atomic.Pointer[Settings]
 }
 
-func NewHandlers(service *service.OrderService) *Handlers {
-	return &Handlers{
-		service: service,
+func NewHandlers(service *service.OrderService, settings Settings, reloader Reloader) *Handlers {
+	h := &Handlers{
+		service:  service,
+		reloader: reloader,
 	}
+	h.settings.Store(&settings)
+	return h
 }
 
-// GetOrderHandler обрабатывает запрос на получение заказа по ID
+// GetOrderHandler обрабатывает запрос на получение заказа по ID.
+// DELETE удаляет заказ (см. DeleteOrderHandler).
 func (h *Handlers) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
-	// Разрешаем CORS для простоты тестирования
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	h.setCORSHeaders(w, r)
 
 	// Обрабатываем preflight OPTIONS запрос
 	if r.Method == "OPTIONS" {
@@ -30,6 +44,11 @@ func (h *Handlers) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Method == "DELETE" {
+		h.DeleteOrderHandler(w, r)
+		return
+	}
+
 	// Проверяем метод запроса
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -49,13 +68,44 @@ func (h *Handlers) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Received request for order: %s", orderUID)
+	logging.Debugf("Received request for order: %s", orderUID)
+
+	// Архивные заказы видны только через admin API: ?include_deleted=true
+	includeDeleted, err := parseFlag(r.URL.Query(), "include_deleted")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if includeDeleted && !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	// ?version=N - заказ в версии N из истории
+	version := 0
+	if value := r.URL.Query().Get("version"); value != "" {
+		version, err = strconv.Atoi(value)
+		if err != nil || version < 1 {
+			http.Error(w, "version must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
 
 	// Получаем заказ из сервиса
-	order, err := h.service.GetOrder(orderUID)
+	var order *models.Order
+	switch {
+	case version > 0:
+		var revision *repository.Revision
+		revision, err = h.service.GetOrderRevision(r.Context(), orderUID, version, repository.ReadOptions{IncludeDeleted: includeDeleted})
+		if err == nil {
+			order = revision.Order
+		}
+	case includeDeleted:
+		order, err = h.service.GetOrderIncludingDeleted(r.Context(), orderUID)
+	default:
+		order, err = h.service.GetOrder(r.Context(), orderUID)
+	}
 	if err != nil {
-		log.Printf("Order not found: %s, error: %v", orderUID, err)
-		http.Error(w, "Order not found", http.StatusNotFound)
+		writeServiceError(w, "get order "+orderUID, err)
 		return
 	}
 
@@ -66,12 +116,348 @@ func (h *Handlers) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
 	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ") // Для красивого форматирования JSON
 	if err := encoder.Encode(order); err != nil {
-		log.Printf("Failed to encode order: %v", err)
+		logging.Errorf("Failed to encode order: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	logging.Debugf("Order %s sent successfully", orderUID)
+}
+
+// OrderHistoryHandler возвращает версии заказа от первой к последней.
+// Ожидаем путь вида /order/12345/history
+func (h *Handlers) OrderHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	h.setCORSHeaders(w, r)
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	orderUID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/order/"), "/history")
+	if orderUID == "" {
+		http.Error(w, "Order ID is required", http.StatusBadRequest)
+		return
+	}
+	includeDeleted, err := parseFlag(r.URL.Query(), "include_deleted")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if includeDeleted && !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	revisions, err := h.service.GetOrderHistory(r.Context(), orderUID, repository.ReadOptions{IncludeDeleted: includeDeleted})
+	if err != nil {
+		writeServiceError(w, "get order history "+orderUID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(revisions); err != nil {
+		logging.Errorf("Failed to encode order history: %v", err)
+	}
+}
+
+// DeleteOrderHandler удаляет заказ: по умолчанию архивирует (deleted_at),
+// с ?hard=true удаляет из БД. Требует токен admin API.
+// Ожидаем запрос DELETE /order/12345
+func (h *Handlers) DeleteOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	orderUID := strings.TrimPrefix(r.URL.Path, "/order/")
+	if orderUID == "" {
+		http.Error(w, "Order ID is required", http.StatusBadRequest)
+		return
+	}
+	hard, err := parseFlag(r.URL.Query(), "hard")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if hard {
+		err = h.service.DeleteOrder(r.Context(), orderUID)
+	} else {
+		err = h.service.ArchiveOrder(r.Context(), orderUID)
+	}
+	if err != nil {
+		writeServiceError(w, "delete order "+orderUID, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FindOrdersHandler возвращает заказы по вторичному полю, значение - последний сегмент пути.
+// Ожидаем путь вида /orders/by-track/WBILMTESTTRACK
+func (h *Handlers) FindOrdersHandler(field models.LookupField, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.setCORSHeaders(w, r)
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		value := strings.TrimPrefix(r.URL.Path, prefix)
+		if value == "" {
+			http.Error(w, "Lookup value is required", http.StatusBadRequest)
+			return
+		}
+
+		orders, err := h.service.FindOrders(r.Context(), field, value)
+		if err != nil {
+			writeServiceError(w, "find orders by "+string(field)+"="+value, err)
+			return
+		}
+		if orders == nil {
+			orders = []*models.Order{}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(orders); err != nil {
+			logging.Errorf("Failed to encode orders: %v", err)
+		}
+	}
+}
+
+// ListOrdersHandler возвращает страницу заказов по фильтрам из параметров запроса:
+// /orders?customer_id=test&created_from=2021-11-01T00:00:00Z&limit=20&cursor=...
+func (h *Handlers) ListOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	h.setCORSHeaders(w, r)
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := parseOrderFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.IncludeDeleted && !h.authorizeAdmin(w, r) {
+		return
+	}
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > repository.MaxListLimit {
+			http.Error(w, fmt.Sprintf("limit must be an integer from 1 to %d", repository.MaxListLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := h.service.ListOrders(r.Context(), filter, query.Get("cursor"), limit)
+	if err != nil {
+		writeServiceError(w, "list orders", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(page); err != nil {
+		logging.Errorf("Failed to encode orders: %v", err)
+	}
+}
+
+// SearchOrdersHandler ищет заказы по тексту: /orders/search?q=Vivienne+Sabo&limit=20&offset=20
+func (h *Handlers) SearchOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	h.setCORSHeaders(w, r)
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	q := query.Get("q")
+	if strings.TrimSpace(q) == "" {
+		http.Error(w, "Search query q is required", http.StatusBadRequest)
+		return
+	}
+
+	var page repository.SearchPage
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > repository.MaxSearchLimit {
+			http.Error(w, fmt.Sprintf("limit must be an integer from 1 to %d", repository.MaxSearchLimit), http.StatusBadRequest)
+			return
+		}
+		page.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		page.Offset = offset
+	}
+
+	results, err := h.service.SearchOrders(r.Context(), q, page)
+	if err != nil {
+		writeServiceError(w, "search orders", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	// Разметка <mark> в highlights остается читаемой, текст полей уже экранирован
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(results); err != nil {
+		logging.Errorf("Failed to encode search results: %v", err)
+	}
+}
+
+// parseOrderFilter разбирает фильтры ListOrdersHandler. Даты - RFC 3339,
+// created_to не включается в выборку.
+func parseOrderFilter(query url.Values) (repository.OrderFilter, error) {
+	filter := repository.OrderFilter{
+		CustomerID:      query.Get("customer_id"),
+		DeliveryService: query.Get("delivery_service"),
+		Locale:          query.Get("locale"),
+		Entry:           query.Get("entry"),
+		Provider:        query.Get("provider"),
+		Bank:            query.Get("bank"),
+		Currency:        query.Get("currency"),
+		Brand:           query.Get("brand"),
+	}
+
+	includeDeleted, err := parseFlag(query, "include_deleted")
+	if err != nil {
+		return filter, err
+	}
+	filter.IncludeDeleted = includeDeleted
+
+	times := []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"created_from", &filter.CreatedFrom},
+		{"created_to", &filter.CreatedTo},
+	}
+	for _, t := range times {
+		if value := query.Get(t.name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be a RFC 3339 time, got %q", t.name, value)
+			}
+			*t.dst = parsed
+		}
+	}
+
+	amounts := []struct {
+		name string
+		dst  **int
+	}{
+		{"amount_min", &filter.AmountMin},
+		{"amount_max", &filter.AmountMax},
+	}
+	for _, a := range amounts {
+		if value := query.Get(a.name); value != "" {
+			amount, err := strconv.Atoi(value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an integer, got %q", a.name, value)
+			}
+			*a.dst = &amount
+		}
+	}
+	return filter, nil
+}
+
+// parseFlag разбирает булев параметр запроса, отсутствующий параметр - false
+func parseFlag(query url.Values, name string) (bool, error) {
+	value := query.Get(name)
+	if value == "" {
+		return false, nil
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got %q", name, value)
+	}
+	return flag, nil
+}
+
+// statusClientClosedRequest - клиент закрыл соединение до ответа (код nginx).
+// Ответ никто не прочитает, но код попадает в лог запросов и метрики.
+const statusClientClosedRequest = 499
+
+// writeServiceError отвечает на ошибку сервиса заказов: 404 - заказа нет,
+// 400 - некорректный запрос, 504 - истек дедлайн операции, 499 - клиент
+// отменил запрос, иначе 500.
+func writeServiceError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		logging.Debugf("Failed to %s: %v", op, err)
+		http.Error(w, "Order not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidLookup), errors.Is(err, repository.ErrInvalidCursor),
+		errors.Is(err, repository.ErrInvalidQuery):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrTimeout):
+		logging.Warnf("Failed to %s: %v", op, err)
+		http.Error(w, "Request timed out", http.StatusGatewayTimeout)
+	case errors.Is(err, context.Canceled):
+		logging.Debugf("Failed to %s: request canceled", op)
+		http.Error(w, "Request canceled", statusClientClosedRequest)
+	default:
+		logging.Errorf("Failed to %s: %v", op, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ReloadConfigHandler перечитывает конфигурацию и применяет изменения без перезапуска
+func (h *Handlers) ReloadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	result, err := h.reloader.Reload()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
 		return
 	}
 
-	log.Printf("Order %s sent successfully", orderUID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
 
 // HealthCheckHandler для проверки работоспособности сервиса
@@ -80,9 +466,34 @@ func (h *Handlers) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":    "ok",
 		"cacheSize": h.service.GetCacheSize(),
+		"warmup":    h.service.WarmupStatus(),
 	})
 }
 
+// ReadyHandler сообщает, готов ли сервис принимать трафик: 503, пока кэш прогревается.
+// Чтения во время прогрева работают, но идут в БД.
+func (h *Handlers) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	warmup := h.service.WarmupStatus()
+
+	status, code := "ready", http.StatusOK
+	if !warmup.Ready {
+		status, code = "warming up", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"warmup": warmup,
+	})
+}
+
+// CacheStatsHandler возвращает статистику кэша и загрузок из БД
+func (h *Handlers) CacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.service.Stats())
+}
+
 // NotFoundHandler для несуществующих маршрутов
 func (h *Handlers) NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -91,3 +502,40 @@ func (h *Handlers) NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 		"error": "Endpoint not found",
 	})
 }
+
+// setCORSHeaders выставляет CORS заголовки согласно списку разрешенных origins
+func (h *Handlers) setCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	origins := h.settings.Load().CORSOrigins
+	origin := r.Header.Get("Origin")
+
+	for _, allowed := range origins {
+		if allowed == "*" {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			break
+		}
+		if origin != "" && allowed == origin {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+			break
+		}
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "GET, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+}
+
+// authorizeAdmin проверяет токен admin API в заголовке Authorization: Bearer <token>
+func (h *Handlers) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := h.settings.Load().AdminToken
+	if token == "" {
+		http.Error(w, "Admin API is disabled", http.StatusForbidden)
+		return false
+	}
+
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
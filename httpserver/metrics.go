@@ -0,0 +1,76 @@
+package httpserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// metricsWriter выводит метрики в текстовом формате Prometheus
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (m metricsWriter) counter(name, help string, value float64) {
+	m.metric(name, "counter", help, value)
+}
+
+func (m metricsWriter) gauge(name, help string, value float64) {
+	m.metric(name, "gauge", help, value)
+}
+
+// summary выводит summary без квантилей: только _count и _sum одного семейства
+func (m metricsWriter) summary(name, help string, count uint64, sum float64) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s summary\n%s_sum %g\n%s_count %d\n", name, help, name, name, sum, name, count)
+}
+
+func (m metricsWriter) metric(name, kind, help string, value float64) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+}
+
+// MetricsHandler отдает статистику сервиса в формате Prometheus
+func (h *Handlers) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := h.service.Stats()
+	warmup := h.service.WarmupStatus()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := metricsWriter{w: w}
+
+	m.counter("orders_cache_hits_total", "Order lookups served from cache.", float64(stats.Cache.Hits))
+	m.counter("orders_cache_misses_total", "Order lookups not found in cache.", float64(stats.Cache.Misses))
+	m.counter("orders_cache_evictions_total", "Orders evicted from cache by size limits.", float64(stats.Cache.Evictions))
+	m.counter("orders_cache_expirations_total", "Orders removed from cache after TTL.", float64(stats.Cache.Expirations))
+	m.gauge("orders_cache_entries", "Orders currently in cache.", float64(stats.Cache.Entries))
+	m.gauge("orders_cache_bytes", "Estimated memory used by cached orders.", float64(stats.Cache.Bytes))
+
+	m.counter("orders_negative_cache_hits_total", "Lookups of unknown orders answered without the database.", float64(stats.NegativeHits))
+	m.gauge("orders_negative_cache_entries", "Unknown order UIDs currently remembered.", float64(stats.NegativeSize))
+
+	m.counter("orders_db_fallbacks_total", "Cache misses loaded from the database.", float64(stats.DBFallbacks))
+	m.counter("orders_db_load_errors_total", "Database loads that failed or found nothing.", float64(stats.DBLoadErrors))
+	m.counter("orders_db_loads_deduplicated_total", "Cache misses that joined an in-flight database load.", float64(stats.Deduplicated))
+	m.summary("orders_db_load_seconds", "Time spent loading orders from the database.", stats.LoadLatency.Count, stats.LoadLatency.TotalMs/1000)
+	m.gauge("orders_db_load_seconds_max", "Slowest database load since start.", stats.LoadLatency.MaxMs/1000)
+
+	if pool := stats.DBPool; pool != nil {
+		m.gauge("orders_db_pool_max_open", "Maximum open database connections, 0 - unlimited.", float64(pool.MaxOpen))
+		m.gauge("orders_db_pool_open", "Open database connections.", float64(pool.Open))
+		m.gauge("orders_db_pool_in_use", "Database connections in use.", float64(pool.InUse))
+		m.gauge("orders_db_pool_idle", "Idle database connections.", float64(pool.Idle))
+		m.counter("orders_db_pool_wait_count_total", "Queries that waited for a free database connection.", float64(pool.WaitCount))
+		m.counter("orders_db_pool_wait_seconds_total", "Total time spent waiting for a free database connection.", pool.WaitMs/1000)
+		m.counter("orders_db_pool_closed_idle_total", "Database connections closed as idle.", float64(pool.ClosedIdle))
+		m.counter("orders_db_pool_closed_lifetime_total", "Database connections closed after max lifetime.", float64(pool.ClosedLifetime))
+	}
+
+	m.gauge("orders_cache_warmup_loaded", "Orders loaded into cache by warm-up.", float64(warmup.Loaded))
+	m.gauge("orders_cache_warmup_total", "Orders to load by warm-up.", float64(warmup.Total))
+	m.gauge("orders_ready", "Whether the service is ready to receive traffic (1) or still warming up (0).", boolFloat(warmup.Ready))
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
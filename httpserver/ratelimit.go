@@ -0,0 +1,54 @@
+package httpserver
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter - общий для всех клиентов token bucket
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // токенов в секунду, 0 - без ограничения
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// SetLimit меняет лимит без сброса уже накопленных токенов
+func (l *rateLimiter) SetLimit(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = rate
+	l.burst = float64(burst)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	if l.last.IsZero() {
+		l.tokens = l.burst
+		l.last = time.Now()
+	}
+}
+
+// Allow сообщает, можно ли обработать очередной запрос
+func (l *rateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
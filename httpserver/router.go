@@ -4,32 +4,107 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"wb-orders-service/config"
+	"wb-orders-service/models"
 	"wb-orders-service/service"
 )
 
+// Settings - параметры HTTP слоя, которые можно менять без перезапуска
+type Settings struct {
+	CORSOrigins []string
+	RateLimit   float64 // запросов в секунду, 0 - без ограничения
+	RateBurst   int
+	AdminToken  string
+}
+
+// Reloader перечитывает конфигурацию сервиса (см. config.Reloader)
+type Reloader interface {
+	Reload() (*config.ReloadResult, error)
+}
+
+// Пути поиска заказов по вторичным полям: /orders/by-track/{track_number} и т.д.
+var lookupRoutes = []struct {
+	prefix string
+	field  models.LookupField
+}{
+	{"/orders/by-track/", models.ByTrackNumber},
+	{"/orders/by-customer/", models.ByCustomerID},
+	{"/orders/by-rid/", models.ByRid},
+	{"/orders/by-chrt/", models.ByChrtID},
+}
+
 type Router struct {
 	handlers *Handlers
+	limiter  rateLimiter
 }
 
-func NewRouter(service *service.OrderService) *Router {
-	return &Router{
-		handlers: NewHandlers(service),
+func NewRouter(service *service.OrderService, settings Settings, reloader Reloader) *Router {
+	r := &Router{
+		handlers: NewHandlers(service, settings, reloader),
 	}
+	r.limiter.SetLimit(settings.RateLimit, settings.RateBurst)
+	return r
+}
+
+// Apply применяет новые настройки к следующим запросам
+func (r *Router) Apply(settings Settings) {
+	r.handlers.settings.Store(&settings)
+	r.limiter.SetLimit(settings.RateLimit, settings.RateBurst)
 }
 
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// health check, метрики, статистику и admin API не ограничиваем, чтобы не потерять управление под нагрузкой
+	if !isServicePath(req.URL.Path) && !r.limiter.Allow() {
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
 	switch {
 	case req.URL.Path == "/":
 		r.serveIndex(w, req)
 	case req.URL.Path == "/health":
 		r.handlers.HealthCheckHandler(w, req)
+	case req.URL.Path == "/ready":
+		r.handlers.ReadyHandler(w, req)
+	case req.URL.Path == "/cache/stats":
+		r.handlers.CacheStatsHandler(w, req)
+	case req.URL.Path == "/metrics":
+		r.handlers.MetricsHandler(w, req)
+	case req.URL.Path == "/admin/reload":
+		r.handlers.ReloadConfigHandler(w, req)
+	case strings.HasPrefix(req.URL.Path, "/order/") && strings.HasSuffix(req.URL.Path[7:], "/history"):
+		r.handlers.OrderHistoryHandler(w, req)
 	case len(req.URL.Path) > 7 && req.URL.Path[:7] == "/order/":
 		r.handlers.GetOrderHandler(w, req)
+	case req.URL.Path == "/orders":
+		r.handlers.ListOrdersHandler(w, req)
+	case req.URL.Path == "/orders/search":
+		r.handlers.SearchOrdersHandler(w, req)
+	case strings.HasPrefix(req.URL.Path, "/orders/by-"):
+		r.serveLookup(w, req)
 	default:
 		r.handlers.NotFoundHandler(w, req)
 	}
 }
 
+// serveLookup выбирает поле поиска по префиксу пути
+func (r *Router) serveLookup(w http.ResponseWriter, req *http.Request) {
+	for _, route := range lookupRoutes {
+		if strings.HasPrefix(req.URL.Path, route.prefix) {
+			r.handlers.FindOrdersHandler(route.field, route.prefix)(w, req)
+			return
+		}
+	}
+	r.handlers.NotFoundHandler(w, req)
+}
+
+// isServicePath сообщает, относится ли путь к служебным эндпоинтам
+func isServicePath(path string) bool {
+	return path == "/health" || path == "/ready" || path == "/metrics" || path == "/cache/stats" ||
+		strings.HasPrefix(path, "/admin/")
+}
+
 func (r *Router) serveIndex(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "GET" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level - уровень детализации логов
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var current atomic.Int32
+
+func init() {
+	current.Store(int32(LevelInfo))
+}
+
+// ParseLevel разбирает название уровня: debug, info, warn или error
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// SetLevel меняет уровень логирования, безопасно вызывать из любой горутины
+func SetLevel(name string) error {
+	level, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	current.Store(int32(level))
+	return nil
+}
+
+// Enabled сообщает, будут ли выведены сообщения указанного уровня
+func Enabled(level Level) bool {
+	return Level(current.Load()) <= level
+}
+
+func Debugf(format string, args ...interface{}) {
+	output(LevelDebug, format, args...)
+}
+
+func Infof(format string, args ...interface{}) {
+	output(LevelInfo, format, args...)
+}
+
+func Warnf(format string, args ...interface{}) {
+	output(LevelWarn, format, args...)
+}
+
+func Errorf(format string, args ...interface{}) {
+	output(LevelError, format, args...)
+}
+
+func output(level Level, format string, args ...interface{}) {
+	if !Enabled(level) {
+		return
+	}
+	// calldepth 3: output -> Debugf/Infof/... -> вызывающий код
+	log.Output(3, fmt.Sprintf(format, args...))
+}
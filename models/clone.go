@@ -0,0 +1,21 @@
+package models
+
+// Clone возвращает независимую копию заказа. Все поля, кроме Items и DeletedAt, -
+// значения или неизменяемые строки.
+// При добавлении в Order полей-ссылок (срезов, map, указателей) их нужно копировать здесь.
+func (o *Order) Clone() *Order {
+	if o == nil {
+		return nil
+	}
+
+	clone := *o
+	if o.Items != nil {
+		clone.Items = make([]Item, len(o.Items))
+		copy(clone.Items, o.Items)
+	}
+	if o.DeletedAt != nil {
+		deletedAt := *o.DeletedAt
+		clone.DeletedAt = &deletedAt
+	}
+	return &clone
+}
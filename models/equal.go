@@ -0,0 +1,31 @@
+package models
+
+import (
+	"reflect"
+)
+
+// Equal сообщает, совпадают ли данные заказов. Время создания сравнивается
+// как момент времени, служебные поля ID/OrderUID доставки и товаров и
+// DeletedAt, которые заполняет хранилище, не учитываются.
+func (o *Order) Equal(other *Order) bool {
+	if o == nil || other == nil {
+		return o == other
+	}
+	a, b := o.comparable(), other.comparable()
+	return reflect.DeepEqual(a, b)
+}
+
+// comparable возвращает копию заказа, приведенную к виду для сравнения
+func (o *Order) comparable() *Order {
+	c := o.Clone()
+	c.DateCreated = c.DateCreated.UTC()
+	c.DeletedAt = nil
+	c.Delivery.ID, c.Delivery.OrderUID = 0, ""
+	if len(c.Items) == 0 {
+		c.Items = nil
+	}
+	for i := range c.Items {
+		c.Items[i].ID, c.Items[i].OrderUID = 0, ""
+	}
+	return c
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"strconv"
+)
+
+// LookupField - поле, по которому можно искать заказы помимо order_uid
+type LookupField string
+
+const (
+	ByTrackNumber LookupField = "track_number" // заказа или любого его товара
+	ByCustomerID  LookupField = "customer_id"
+	ByRid         LookupField = "rid"
+	ByChrtID      LookupField = "chrt_id"
+)
+
+// LookupFields перечисляет все поля для поиска
+var LookupFields = []LookupField{ByTrackNumber, ByCustomerID, ByRid, ByChrtID}
+
+// LookupValues возвращает значения поля field, по которым заказ должен находиться
+func (o *Order) LookupValues(field LookupField) []string {
+	var values []string
+	add := func(value string) {
+		if value == "" {
+			return
+		}
+		for _, v := range values {
+			if v == value {
+				return
+			}
+		}
+		values = append(values, value)
+	}
+
+	switch field {
+	case ByTrackNumber:
+		add(o.TrackNumber)
+		for _, item := range o.Items {
+			add(item.TrackNumber)
+		}
+	case ByCustomerID:
+		add(o.CustomerID)
+	case ByRid:
+		for _, item := range o.Items {
+			add(item.Rid)
+		}
+	case ByChrtID:
+		for _, item := range o.Items {
+			add(strconv.FormatInt(item.ChrtID, 10))
+		}
+	}
+	return values
+}
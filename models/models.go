@@ -20,6 +20,10 @@ type Order struct {
 	SmID              int       `json:"sm_id" db:"sm_id"`
 	DateCreated       time.Time `json:"date_created" db:"date_created"`
 	OofShard          string    `json:"oof_shard" db:"oof_shard"`
+
+	// Время архивации заказа; заполняется хранилищем только при явном чтении
+	// архивных заказов, из сообщений не принимается
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
 // Delivery представляет данные о доставке
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"fmt"
+)
+
+// ValidationRules - настраиваемые правила проверки входящих заказов
+type ValidationRules struct {
+	RequireTrackNumber bool
+	RequireEntry       bool
+	MaxItems           int      // 0 - без ограничения
+	Currencies         []string // пусто - любая валюта
+}
+
+// DefaultValidationRules возвращает правила, действовавшие до появления настроек
+func DefaultValidationRules() ValidationRules {
+	return ValidationRules{
+		RequireTrackNumber: true,
+		RequireEntry:       true,
+	}
+}
+
+// Validate проверяет корректность данных заказа
+func (o *Order) Validate(rules ValidationRules) error {
+	// order_uid и payment.transaction обязательны всегда:
+	// на них завязаны первичные и внешние ключи в БД
+	if o.OrderUID == "" {
+		return fmt.Errorf("order_uid is required")
+	}
+	if rules.RequireTrackNumber && o.TrackNumber == "" {
+		return fmt.Errorf("track_number is required")
+	}
+	if rules.RequireEntry && o.Entry == "" {
+		return fmt.Errorf("entry is required")
+	}
+	if o.Payment.Transaction == "" {
+		return fmt.Errorf("payment.transaction is required")
+	}
+	if o.Payment.Transaction != o.OrderUID {
+		return fmt.Errorf("payment.transaction must match order_uid")
+	}
+	if rules.MaxItems > 0 && len(o.Items) > rules.MaxItems {
+		return fmt.Errorf("too many items: %d, max %d", len(o.Items), rules.MaxItems)
+	}
+	if len(rules.Currencies) > 0 && !contains(rules.Currencies, o.Payment.Currency) {
+		return fmt.Errorf("payment.currency %q is not allowed", o.Payment.Currency)
+	}
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,14 @@
 package nats
 
 import (
+	"context"
 	"encoding/json"
-	"log"
-	"fmt"
+	"errors"
+	"sync/atomic"
+	"time"
+	"wb-orders-service/logging"
 	"wb-orders-service/models"
+	"wb-orders-service/repository"
 	"wb-orders-service/service"
 
 	"github.com/nats-io/stan.go"
@@ -17,16 +21,35 @@ type Subscriber struct {
 	subject   string
 	service   *service.OrderService
 	conn      stan.Conn
+	rules     atomic.Pointer[models.ValidationRules]
+	policy    atomic.Int64 // repository.SavePolicy
+
+	// ctx отменяется в Close и прерывает сохранение обрабатываемого сообщения
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewSubscriber(clusterID, clientID, url, subject string, service *service.OrderService) *Subscriber {
-	return &Subscriber{
+	s := &Subscriber{
 		clusterID: clusterID,
 		clientID:  clientID,
 		url:       url,
 		subject:   subject,
 		service:   service,
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.SetValidationRules(models.DefaultValidationRules())
+	return s
+}
+
+// SetValidationRules меняет правила проверки заказов, применяется к следующим сообщениям
+func (s *Subscriber) SetValidationRules(rules models.ValidationRules) {
+	s.rules.Store(&rules)
+}
+
+// SetSavePolicy задает, что делать с заказом, order_uid которого уже сохранен
+func (s *Subscriber) SetSavePolicy(policy repository.SavePolicy) {
+	s.policy.Store(int64(policy))
 }
 
 // Connect подключается к NATS Streaming
@@ -36,7 +59,7 @@ func (s *Subscriber) Connect() error {
 		return err
 	}
 	s.conn = conn
-	log.Printf("Connected to NATS Streaming: %s", s.url)
+	logging.Infof("Connected to NATS Streaming: %s", s.url)
 	return nil
 }
 
@@ -44,7 +67,7 @@ func (s *Subscriber) Connect() error {
 func (s *Subscriber) Subscribe() (stan.Subscription, error) {
 	subscription, err := s.conn.Subscribe(s.subject, func(msg *stan.Msg) {
 		if err := s.processMessage(msg); err != nil {
-			log.Printf("Failed to process message: %v", err)
+			logging.Errorf("Failed to process message: %v", err)
 		}
 	}, stan.DeliverAllAvailable())
 
@@ -52,58 +75,75 @@ func (s *Subscriber) Subscribe() (stan.Subscription, error) {
 		return nil, err
 	}
 
-	log.Printf("Subscribed to subject: %s", s.subject)
+	logging.Infof("Subscribed to subject: %s", s.subject)
 	return subscription, nil
 }
 
 // processMessage обрабатывает входящее сообщение
 func (s *Subscriber) processMessage(msg *stan.Msg) error {
-	log.Printf("Received message: %s", string(msg.Data))
+	logging.Debugf("Received message: %s", string(msg.Data))
 
 	var order models.Order
 	if err := json.Unmarshal(msg.Data, &order); err != nil {
-		log.Printf("Failed to unmarshal message: %v", err)
+		logging.Warnf("Failed to unmarshal message: %v", err)
 		return err
 	}
 
 	// Валидация данных
-	if err := s.validateOrder(&order); err != nil {
-		log.Printf("Order validation failed: %v", err)
+	if err := order.Validate(*s.rules.Load()); err != nil {
+		logging.Warnf("Order validation failed: %v", err)
 		return err
 	}
 
-	// Сохраняем заказ через сервис
-	if err := s.service.SaveOrder(&order); err != nil {
-		log.Printf("Failed to save order: %v", err)
+	// Сохраняем заказ через сервис вместе с исходным сообщением (история версий,
+	// raw_orders); повторная доставка того же заказа не ошибка
+	opts := repository.SaveOptions{
+		Policy:    repository.SavePolicy(s.policy.Load()),
+		Source:    "nats",
+		Message:   msg.Data,
+		Sequence:  msg.Sequence,
+		Timestamp: time.Unix(0, msg.Timestamp),
+	}
+	result, err := s.service.SaveOrder(s.ctx, &order, opts)
+	if opts.Policy == repository.SaveUpdate && errors.Is(err, repository.ErrConflict) {
+		return s.updateOrder(&order, opts)
+	}
+	if errors.Is(err, repository.ErrConflict) {
+		logging.Warnf("Order %s rejected: %v", order.OrderUID, err)
+		return err
+	}
+	if err != nil {
+		logging.Warnf("Failed to save order: %v", err)
 		return err
 	}
 
-	log.Printf("Order %s processed successfully", order.OrderUID)
+	logging.Infof("Order %s processed successfully (%s)", order.OrderUID, result)
 	return nil
 }
 
-// validateOrder проверяет корректность данных заказа
-func (s *Subscriber) validateOrder(order *models.Order) error {
-	if order.OrderUID == "" {
-		return fmt.Errorf("order_uid is required")
-	}
-	if order.TrackNumber == "" {
-		return fmt.Errorf("track_number is required")
-	}
-	if order.Entry == "" {
-		return fmt.Errorf("entry is required")
-	}
-	if order.Payment.Transaction == "" {
-		return fmt.Errorf("payment.transaction is required")
-	}
-	if order.Payment.Transaction != order.OrderUID {
-		return fmt.Errorf("payment.transaction must match order_uid")
+// updateOrder записывает сообщение для уже сохраненного заказа его новой версией
+func (s *Subscriber) updateOrder(order *models.Order, opts repository.SaveOptions) error {
+	result, err := s.service.UpdateOrder(s.ctx, order, opts)
+	if err != nil {
+		logging.Warnf("Failed to update order %s: %v", order.OrderUID, err)
+		return err
 	}
+
+	logging.Infof("Order %s processed successfully (version %d)", order.OrderUID, result.Version)
 	return nil
 }
 
+// Publish публикует сообщение в канал NATS Streaming и ждет подтверждения
+func (s *Subscriber) Publish(subject string, data []byte) error {
+	if s.conn == nil {
+		return errors.New("not connected to NATS")
+	}
+	return s.conn.Publish(subject, data)
+}
+
 // Close закрывает соединение
 func (s *Subscriber) Close() {
+	s.cancel()
 	if s.conn != nil {
 		s.conn.Close()
 	}
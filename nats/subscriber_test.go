@@ -0,0 +1,62 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+	"wb-orders-service/repository/repotest"
+	"wb-orders-service/service"
+
+	"github.com/nats-io/stan.go"
+	"github.com/nats-io/stan.go/pb"
+)
+
+func message(t *testing.T, order *models.Order, sequence uint64) *stan.Msg {
+	t.Helper()
+	data, err := json.Marshal(order)
+	if err != nil {
+		t.Fatalf("failed to marshal order: %v", err)
+	}
+	return &stan.Msg{MsgProto: pb.MsgProto{Sequence: sequence, Data: data, Timestamp: time.Now().UnixNano()}}
+}
+
+func TestProcessMessageUpdatesExistingOrder(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	svc := service.NewOrderService(repo, service.Options{})
+	defer svc.Close()
+
+	sub := NewSubscriber("cluster", "client", "", "orders", svc)
+	defer sub.Close()
+	sub.SetSavePolicy(repository.SaveUpdate)
+
+	order := repotest.NewOrder("sub-update", time.Now())
+	if err := sub.processMessage(message(t, order, 1)); err != nil {
+		t.Fatalf("first message: %v", err)
+	}
+	order.TrackNumber = "TRACK-UPDATED"
+	if err := sub.processMessage(message(t, order, 2)); err != nil {
+		t.Fatalf("second message: %v", err)
+	}
+
+	history, err := svc.GetOrderHistory(context.Background(), order.OrderUID, repository.ReadOptions{})
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	if len(history) != 2 || history[0].Version != 1 || history[1].Version != 2 {
+		t.Fatalf("want versions 1 and 2, got %+v", history)
+	}
+	if history[1].Order.TrackNumber != "TRACK-UPDATED" {
+		t.Errorf("version 2 track_number = %q, want TRACK-UPDATED", history[1].Order.TrackNumber)
+	}
+
+	got, err := svc.GetOrder(context.Background(), order.OrderUID)
+	if err != nil {
+		t.Fatalf("failed to get order: %v", err)
+	}
+	if got.TrackNumber != "TRACK-UPDATED" {
+		t.Errorf("track_number = %q, want TRACK-UPDATED", got.TrackNumber)
+	}
+}
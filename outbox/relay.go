@@ -0,0 +1,155 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wb-orders-service/logging"
+	"wb-orders-service/repository"
+)
+
+// Как часто удалять отправленные события старше Retention
+const cleanupInterval = time.Hour
+
+// Publisher публикует сообщение в канал, например nats.Subscriber
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// Options - настройки Relay
+type Options struct {
+	Subject      string        // канал для событий о заказах
+	PollInterval time.Duration // пауза между опросами outbox, когда событий нет
+	BatchSize    int           // событий за один опрос
+	Lease        time.Duration // на сколько событие резервируется за экземпляром
+	RetryMin     time.Duration // пауза перед повтором после первой ошибки
+	RetryMax     time.Duration // предел паузы перед повтором
+	Retention    time.Duration // сколько хранить отправленные события, 0 - всегда
+}
+
+// Relay публикует события из outbox. Несколько экземпляров сервиса могут
+// работать с одной БД: событие резервируется за одним из них, события
+// одного заказа публикуются по порядку версий. Доставка "хотя бы один раз":
+// получатели отбрасывают повторы по order_uid и version.
+type Relay struct {
+	store repository.OutboxStore
+	pub   Publisher
+	opts  atomic.Pointer[Options]
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewRelay создает Relay и запускает публикацию в фоне
+func NewRelay(store repository.OutboxStore, pub Publisher, opts Options) *Relay {
+	r := &Relay{
+		store: store,
+		pub:   pub,
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.opts.Store(&opts)
+
+	r.wg.Add(1)
+	go r.loop()
+
+	logging.Infof("Outbox relay started, subject: %s", opts.Subject)
+	return r
+}
+
+// SetOptions применяет новые настройки со следующего опроса
+func (r *Relay) SetOptions(opts Options) {
+	r.opts.Store(&opts)
+}
+
+// Close останавливает публикацию и ждет завершения текущего опроса
+func (r *Relay) Close() {
+	r.closeOnce.Do(func() {
+		r.cancel()
+		r.wg.Wait()
+	})
+}
+
+// RunOnce резервирует и публикует одну пачку событий. Возвращает число
+// зарезервированных событий; неопубликованные откладываются с растущей паузой.
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	opts := r.opts.Load()
+	events, err := r.store.ClaimOutboxEvents(ctx, repository.ClaimOptions{
+		Limit: opts.BatchSize,
+		Lease: opts.Lease,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sent := make([]int64, 0, len(events))
+	for _, event := range events {
+		if err := r.pub.Publish(opts.Subject, event.Payload); err != nil {
+			delay := retryDelay(event.Attempts, opts.RetryMin, opts.RetryMax)
+			logging.Warnf("Failed to publish %s event for order %s (attempt %d), retrying in %s: %v",
+				event.Type, event.OrderUID, event.Attempts, delay, err)
+			if err := r.store.MarkOutboxFailed(ctx, event.ID, time.Now().Add(delay), err.Error()); err != nil {
+				logging.Errorf("Failed to reschedule outbox event %d: %v", event.ID, err)
+			}
+			continue
+		}
+		sent = append(sent, event.ID)
+	}
+
+	if len(sent) == 0 {
+		return len(events), nil
+	}
+	// Если отметка не удалась, события опубликуются повторно после истечения Lease
+	if err := r.store.MarkOutboxSent(ctx, sent); err != nil {
+		return len(events), err
+	}
+	logging.Debugf("Published %d order events", len(sent))
+	return len(events), nil
+}
+
+// loop опрашивает outbox до Close: полные пачки выбираются без паузы
+func (r *Relay) loop() {
+	defer r.wg.Done()
+
+	var lastCleanup time.Time
+	for {
+		opts := r.opts.Load()
+		claimed, err := r.RunOnce(r.ctx)
+		if r.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logging.Errorf("Outbox relay failed: %v", err)
+		}
+
+		if opts.Retention > 0 && time.Since(lastCleanup) >= cleanupInterval {
+			lastCleanup = time.Now()
+			deleted, err := r.store.DeleteSentOutboxEvents(r.ctx, lastCleanup.Add(-opts.Retention))
+			if err != nil {
+				logging.Errorf("Failed to delete sent outbox events: %v", err)
+			} else if deleted > 0 {
+				logging.Infof("Deleted %d sent outbox events", deleted)
+			}
+		}
+
+		if err == nil && claimed > 0 && claimed == opts.BatchSize {
+			continue
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(opts.PollInterval):
+		}
+	}
+}
+
+// retryDelay - пауза перед попыткой attempts+1: удваивается с каждой ошибкой
+func retryDelay(attempts int, retryMin, retryMax time.Duration) time.Duration {
+	delay := retryMin
+	for i := 1; i < attempts && delay < retryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMax)
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"wb-orders-service/models"
+)
+
+// ErrInvalidOrder возвращается для заказа пачки, который нельзя записать
+// в таблицы: без order_uid или с платежом другого заказа
+var ErrInvalidOrder = errors.New("invalid order")
+
+// ImportSource - источник версий заказов, записанных SaveOrdersBatch по умолчанию
+const ImportSource = "import"
+
+// BatchOrder - заказ пачки SaveOrdersBatch
+type BatchOrder struct {
+	Order   *models.Order
+	Message []byte // исходное сообщение (JSON) для истории и raw_orders, nil - нет
+}
+
+// BatchOptions - параметры SaveOrdersBatch
+type BatchOptions struct {
+	Source string // источник версий, пусто - ImportSource
+}
+
+// Rejection - незаписанный заказ пачки
+type Rejection struct {
+	Index    int // позиция в пачке
+	OrderUID string
+	Err      error // обернутая ErrConflict, ErrInvalidMessage или ErrInvalidOrder
+}
+
+// BatchResult - итог SaveOrdersBatch
+type BatchResult struct {
+	Inserted   int
+	Duplicates int         // такой же заказ уже сохранен или встретился в пачке раньше
+	Rejected   []Rejection // по возрастанию Index
+}
+
+func (r *BatchResult) reject(index int, orderUID string, err error) {
+	r.Rejected = append(r.Rejected, Rejection{Index: index, OrderUID: orderUID, Err: err})
+}
+
+func (r *BatchResult) sortRejected() {
+	sort.Slice(r.Rejected, func(i, j int) bool { return r.Rejected[i].Index < r.Rejected[j].Index })
+}
+
+// batchEntry - заказ пачки, допущенный к записи
+type batchEntry struct {
+	index  int
+	order  *models.Order
+	source revisionSource
+}
+
+// prepareBatch отбирает заказы пачки для записи, остальные добавляет в result.
+// Повтор order_uid внутри пачки - дубликат или конфликт, как при повторном сохранении.
+func prepareBatch(batch []BatchOrder, opts BatchOptions, result *BatchResult) []batchEntry {
+	name := opts.Source
+	if name == "" {
+		name = ImportSource
+	}
+
+	entries := make([]batchEntry, 0, len(batch))
+	seen := make(map[string]*models.Order, len(batch))
+	for i, item := range batch {
+		order := item.Order
+		if order == nil || order.OrderUID == "" {
+			result.reject(i, "", fmt.Errorf("%w: order_uid is required", ErrInvalidOrder))
+			continue
+		}
+		// payments.transaction - внешний ключ на orders.order_uid
+		if order.Payment.Transaction != order.OrderUID {
+			result.reject(i, order.OrderUID, fmt.Errorf("%w: payment.transaction must match order_uid", ErrInvalidOrder))
+			continue
+		}
+		source, err := newRevisionSource(SaveOptions{Source: name, Message: item.Message})
+		if err != nil {
+			result.reject(i, order.OrderUID, err)
+			continue
+		}
+
+		if earlier, ok := seen[order.OrderUID]; ok {
+			if earlier.Equal(order) {
+				result.Duplicates++
+			} else {
+				result.reject(i, order.OrderUID, fmt.Errorf("%w: %s differs from an earlier order in the batch", ErrConflict, order.OrderUID))
+			}
+			continue
+		}
+		seen[order.OrderUID] = order
+		entries = append(entries, batchEntry{index: i, order: order, source: source})
+	}
+	return entries
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"time"
+	"wb-orders-service/logging"
+)
+
+// Пауза между попытками подключения при старте растет от connectRetryMin до connectRetryMax
+const (
+	connectRetryMin = 500 * time.Millisecond
+	connectRetryMax = 10 * time.Second
+)
+
+// PoolOptions - настройки пула соединений
+type PoolOptions struct {
+	MaxOpenConns    int           // 0 - без ограничения
+	MaxIdleConns    int           // 0 - не держать простаивающие соединения
+	ConnMaxLifetime time.Duration // 0 - без ограничения
+	ConnMaxIdleTime time.Duration // 0 - без ограничения
+}
+
+// ConnectOptions - параметры подключения к PostgreSQL
+type ConnectOptions struct {
+	Pool PoolOptions
+	// Сколько повторять попытки, пока БД недоступна, 0 - одна попытка
+	RetryTimeout time.Duration
+}
+
+// PoolReporter реализуют хранилища с пулом соединений
+type PoolReporter interface {
+	PoolStats() PoolStats
+}
+
+// PoolStats - состояние пула соединений
+type PoolStats struct {
+	MaxOpen        int     `json:"max_open"`
+	Open           int     `json:"open"`
+	InUse          int     `json:"in_use"`
+	Idle           int     `json:"idle"`
+	WaitCount      int64   `json:"wait_count"`      // запросы, ждавшие свободного соединения
+	WaitMs         float64 `json:"wait_ms"`         // суммарное время ожидания
+	ClosedIdle     int64   `json:"closed_idle"`     // закрыты из-за MaxIdleConns и ConnMaxIdleTime
+	ClosedLifetime int64   `json:"closed_lifetime"` // закрыты из-за ConnMaxLifetime
+}
+
+// NewPostgresRepository подключается к PostgreSQL. Если БД еще не поднялась,
+// попытки повторяются с растущей паузой и случайным разбросом, пока не истечет
+// opts.RetryTimeout или не будет отменен ctx.
+func NewPostgresRepository(ctx context.Context, connStr string, opts ConnectOptions) (*PostgresRepository, error) {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &PostgresRepository{db: db}
+	r.timeouts.Store(&Timeouts{})
+	r.SetPool(opts.Pool)
+
+	if err := ping(ctx, db, opts.RetryTimeout); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// ping проверяет подключение, повторяя попытки до истечения retryTimeout
+func ping(ctx context.Context, db *sql.DB, retryTimeout time.Duration) error {
+	deadline := time.Now().Add(retryTimeout)
+	backoff := connectRetryMin
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		// Полный разброс паузы: экземпляры, стартовавшие вместе, не стучатся в БД одновременно
+		remaining := time.Until(deadline)
+		if ctx.Err() != nil || remaining <= 0 {
+			return fmt.Errorf("failed to connect after %d attempts: %v", attempt, err)
+		}
+		wait := min(rand.N(backoff)+time.Millisecond, remaining)
+		logging.Warnf("Database is not available, retrying in %s: %v", wait.Round(time.Millisecond), err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to connect after %d attempts: %v", attempt, ctx.Err())
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, connectRetryMax)
+	}
+}
+
+// SetPool меняет настройки пула соединений без переподключения
+func (r *PostgresRepository) SetPool(opts PoolOptions) {
+	r.db.SetMaxOpenConns(opts.MaxOpenConns)
+	r.db.SetMaxIdleConns(opts.MaxIdleConns)
+	r.db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	r.db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+}
+
+// PoolStats возвращает состояние пула соединений
+func (r *PostgresRepository) PoolStats() PoolStats {
+	stats := r.db.Stats()
+	return PoolStats{
+		MaxOpen:        stats.MaxOpenConnections,
+		Open:           stats.OpenConnections,
+		InUse:          stats.InUse,
+		Idle:           stats.Idle,
+		WaitCount:      stats.WaitCount,
+		WaitMs:         float64(stats.WaitDuration) / float64(time.Millisecond),
+		ClosedIdle:     stats.MaxIdleClosed + stats.MaxIdleTimeClosed,
+		ClosedLifetime: stats.MaxLifetimeClosed,
+	}
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"wb-orders-service/models"
+)
+
+// Размер страницы ListOrders
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// ErrInvalidCursor возвращается, если курсор ListOrders не удалось разобрать
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// OrderFilter - условия ListOrders, пустые поля не ограничивают выборку
+type OrderFilter struct {
+	CreatedFrom time.Time // date_created >= CreatedFrom
+	CreatedTo   time.Time // date_created < CreatedTo
+
+	CustomerID      string
+	DeliveryService string
+	Locale          string
+	Entry           string
+
+	Provider  string // поля платежа
+	Bank      string
+	Currency  string
+	AmountMin *int
+	AmountMax *int
+
+	Brand string // хотя бы один товар этого бренда
+
+	IncludeDeleted bool // включать архивные заказы
+}
+
+// Match сообщает, подходит ли заказ под фильтр
+func (f OrderFilter) Match(order *models.Order) bool {
+	if !f.CreatedFrom.IsZero() && order.DateCreated.Before(f.CreatedFrom) {
+		return false
+	}
+	if !f.CreatedTo.IsZero() && !order.DateCreated.Before(f.CreatedTo) {
+		return false
+	}
+
+	fields := []struct{ want, got string }{
+		{f.CustomerID, order.CustomerID},
+		{f.DeliveryService, order.DeliveryService},
+		{f.Locale, order.Locale},
+		{f.Entry, order.Entry},
+		{f.Provider, order.Payment.Provider},
+		{f.Bank, order.Payment.Bank},
+		{f.Currency, order.Payment.Currency},
+	}
+	for _, field := range fields {
+		if field.want != "" && field.want != field.got {
+			return false
+		}
+	}
+
+	if f.AmountMin != nil && order.Payment.Amount < *f.AmountMin {
+		return false
+	}
+	if f.AmountMax != nil && order.Payment.Amount > *f.AmountMax {
+		return false
+	}
+
+	if f.Brand != "" {
+		for _, item := range order.Items {
+			if item.Brand == f.Brand {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// OrderPage - страница ListOrders
+type OrderPage struct {
+	Orders []*models.Order `json:"orders"`
+	// Курсор следующей страницы, пусто - страница последняя
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// listLimit приводит размер страницы к 1..MaxListLimit, 0 - DefaultListLimit
+func listLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultListLimit
+	}
+	return min(limit, MaxListLimit)
+}
+
+// listCursor - позиция последнего заказа страницы в порядке date_created, order_uid
+type listCursor struct {
+	DateCreated time.Time
+	OrderUID    string
+}
+
+// encodeCursor возвращает непрозрачный курсор страницы после order
+func encodeCursor(order *models.Order) string {
+	raw := order.DateCreated.UTC().Format(time.RFC3339Nano) + "|" + order.OrderUID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor разбирает курсор, пустой курсор - первая страница (nil)
+func decodeCursor(cursor string) (*listCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	date, orderUID, ok := strings.Cut(string(raw), "|")
+	if !ok || orderUID == "" {
+		return nil, ErrInvalidCursor
+	}
+	created, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return &listCursor{DateCreated: created, OrderUID: orderUID}, nil
+}
+
+// follows сообщает, идет ли order после курсора при сортировке от новых к старым
+func (c *listCursor) follows(order *models.Order) bool {
+	if !order.DateCreated.Equal(c.DateCreated) {
+		return order.DateCreated.Before(c.DateCreated)
+	}
+	return order.OrderUID < c.OrderUID
+}
@@ -0,0 +1,693 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"wb-orders-service/models"
+)
+
+// MemoryRepository - потокобезопасное хранилище заказов в памяти
+// для тестов и локального запуска без PostgreSQL
+type MemoryRepository struct {
+	mu     sync.RWMutex
+	orders map[string]memoryRecord
+	// order_uid -> время удаления, для DeletedOrderUIDs
+	deleted map[string]time.Time
+
+	outbox    []*memoryOutboxEvent // по возрастанию ID
+	outboxSeq int64
+}
+
+type memoryRecord struct {
+	order     *models.Order // DeletedAt заполнен у архивных заказов
+	createdAt time.Time     // момент записи, аналог orders.created_at
+	revisions []Revision    // история версий, не меняется после записи
+	raw       *RawOrder     // исходное сообщение, nil - нет
+}
+
+// NewMemoryRepository создает пустое хранилище в памяти
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		orders:  make(map[string]memoryRecord),
+		deleted: make(map[string]time.Time),
+	}
+}
+
+// SaveOrder сохраняет копию заказа, поведение при занятом order_uid задает opts.Policy
+func (r *MemoryRepository) SaveOrder(ctx context.Context, order *models.Order, opts SaveOptions) (SaveResult, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, checkTimeout(ctx, "save order", err)
+	}
+	source, err := newRevisionSource(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, exists := r.orders[order.OrderUID]
+	if !exists {
+		_, err := r.write(memoryRecord{}, order, source, EventOrderCreated)
+		return SaveInserted, err
+	}
+
+	result, write, err := resolveExisting(record.order, order, opts.Policy)
+	if result == SaveDuplicate {
+		r.orders[order.OrderUID] = record.withMissingRaw(order.OrderUID, source)
+		return result, nil
+	}
+	if err != nil || !write {
+		return result, err
+	}
+
+	if _, err := r.write(record, order, source, EventOrderUpdated); err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+// SaveOrdersBatch сохраняет пачку новых заказов под одной блокировкой,
+// как SaveOrder с SaveReject; незаписанные заказы возвращаются в результате
+func (r *MemoryRepository) SaveOrdersBatch(ctx context.Context, batch []BatchOrder, opts BatchOptions) (BatchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return BatchResult{}, checkTimeout(ctx, "save orders batch", err)
+	}
+
+	var result BatchResult
+	entries := prepareBatch(batch, opts, &result)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range entries {
+		uid := entry.order.OrderUID
+		record, exists := r.orders[uid]
+		if !exists {
+			if _, err := r.write(memoryRecord{}, entry.order, entry.source, EventOrderCreated); err != nil {
+				return BatchResult{}, err
+			}
+			result.Inserted++
+			continue
+		}
+		if _, _, err := resolveExisting(record.order, entry.order, SaveReject); err != nil {
+			result.reject(entry.index, uid, err)
+			continue
+		}
+		r.orders[uid] = record.withMissingRaw(uid, entry.source)
+		result.Duplicates++
+	}
+
+	result.sortRejected()
+	return result, nil
+}
+
+// UpdateOrder заменяет существующий заказ и добавляет версию
+func (r *MemoryRepository) UpdateOrder(ctx context.Context, order *models.Order, opts SaveOptions) (UpdateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return UpdateResult{}, checkTimeout(ctx, "update order", err)
+	}
+	source, err := newRevisionSource(opts)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, exists := r.orders[order.OrderUID]
+	if !exists || record.archived() {
+		return UpdateResult{}, fmt.Errorf("%w: %s", ErrNotFound, order.OrderUID)
+	}
+	if record.order.Equal(order) {
+		r.orders[order.OrderUID] = record.withMissingRaw(order.OrderUID, source)
+		return UpdateResult{Version: len(record.revisions)}, nil
+	}
+
+	version, err := r.write(record, order, source, EventOrderUpdated)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	return UpdateResult{Version: version, Changed: true}, nil
+}
+
+// write записывает заказ новой версией и добавляет событие eventType в outbox.
+// Вызывается под r.mu.
+func (r *MemoryRepository) write(record memoryRecord, order *models.Order, source revisionSource, eventType string) (int, error) {
+	record = record.replaced(order, source)
+	version := len(record.revisions)
+	payload, err := orderEventPayload(eventType, record.order, version)
+	if err != nil {
+		return 0, err
+	}
+
+	r.orders[order.OrderUID] = record
+	r.outboxSeq++
+	r.outbox = append(r.outbox, &memoryOutboxEvent{
+		OutboxEvent: OutboxEvent{
+			ID:        r.outboxSeq,
+			Type:      eventType,
+			OrderUID:  order.OrderUID,
+			Version:   version,
+			Payload:   payload,
+			CreatedAt: time.Now(),
+		},
+		nextAttempt: time.Now(),
+	})
+	return version, nil
+}
+
+// replaced возвращает запись с заказом order и новой версией в истории.
+// Как и в PostgreSQL, время записи обновляется: замена должна попасть
+// в догрузку заказов после снимка кэша. Архивный заказ возвращается из архива.
+func (rec memoryRecord) replaced(order *models.Order, source revisionSource) memoryRecord {
+	stored := storedCopy(order)
+	revisions := make([]Revision, len(rec.revisions), len(rec.revisions)+1)
+	copy(revisions, rec.revisions)
+	revisions = append(revisions, Revision{
+		Version:   len(rec.revisions) + 1,
+		CreatedAt: time.Now(),
+		Source:    source.name,
+		Message:   bytes.Clone(source.message),
+		Order:     revisionOrder(stored),
+	})
+	raw := source.raw(order.OrderUID)
+	if raw == nil && source.keepsRaw() {
+		raw = rec.raw
+	}
+	return memoryRecord{order: stored, createdAt: time.Now(), revisions: revisions, raw: raw}
+}
+
+// withMissingRaw возвращает запись с исходным сообщением из source, если его еще не было
+func (rec memoryRecord) withMissingRaw(orderUID string, source revisionSource) memoryRecord {
+	if rec.raw == nil {
+		rec.raw = source.raw(orderUID)
+	}
+	return rec
+}
+
+// GetRawOrder возвращает копию исходного сообщения заказа
+func (r *MemoryRepository) GetRawOrder(ctx context.Context, orderUID string) (*RawOrder, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, checkTimeout(ctx, "get raw order", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, exists := r.orders[orderUID]
+	if !exists || record.raw == nil {
+		return nil, fmt.Errorf("%w: raw order %s", ErrNotFound, orderUID)
+	}
+	return record.raw.clone(), nil
+}
+
+// StreamRawOrders передает fn копии исходных сообщений по порядку order_uid.
+// fn вызывается без блокировки и может писать в хранилище.
+func (r *MemoryRepository) StreamRawOrders(ctx context.Context, opts RawStreamOptions, fn func(*RawOrder) error) error {
+	if err := ctx.Err(); err != nil {
+		return checkTimeout(ctx, "stream raw orders", err)
+	}
+
+	r.mu.RLock()
+	var raws []*RawOrder
+	for uid, record := range r.orders {
+		if record.raw != nil && strings.HasPrefix(uid, opts.Prefix) {
+			raws = append(raws, record.raw.clone())
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(raws, func(i, j int) bool { return raws[i].OrderUID < raws[j].OrderUID })
+
+	for _, raw := range raws {
+		if err := ctx.Err(); err != nil {
+			return checkTimeout(ctx, "stream raw orders", err)
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetOrderHistory возвращает копии версий заказа от первой к последней
+func (r *MemoryRepository) GetOrderHistory(ctx context.Context, orderUID string, opts ReadOptions) ([]Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, checkTimeout(ctx, "get order history", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, exists := r.orders[orderUID]
+	if !exists || (record.archived() && !opts.IncludeDeleted) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, orderUID)
+	}
+	revisions := make([]Revision, len(record.revisions))
+	for i, revision := range record.revisions {
+		revisions[i] = revision.clone()
+	}
+	return revisions, nil
+}
+
+// GetOrderRevision возвращает копию версии заказа
+func (r *MemoryRepository) GetOrderRevision(ctx context.Context, orderUID string, version int, opts ReadOptions) (*Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, checkTimeout(ctx, "get order revision", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, exists := r.orders[orderUID]
+	if !exists || (record.archived() && !opts.IncludeDeleted) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, orderUID)
+	}
+	if version < 1 || version > len(record.revisions) {
+		return nil, fmt.Errorf("%w: %s version %d", ErrNotFound, orderUID, version)
+	}
+	revision := record.revisions[version-1].clone()
+	return &revision, nil
+}
+
+// GetOrderByUID возвращает копию заказа по его UID
+func (r *MemoryRepository) GetOrderByUID(ctx context.Context, orderUID string, opts ReadOptions) (*models.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, checkTimeout(ctx, "get order", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, exists := r.orders[orderUID]
+	if !exists || (record.archived() && !opts.IncludeDeleted) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, orderUID)
+	}
+	return record.order.Clone(), nil
+}
+
+// GetOrdersByUIDs возвращает копии найденных заказов в порядке orderUIDs
+func (r *MemoryRepository) GetOrdersByUIDs(ctx context.Context, orderUIDs []string) ([]*models.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, checkTimeout(ctx, "get orders", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	orders := make([]*models.Order, 0, len(orderUIDs))
+	for _, orderUID := range orderUIDs {
+		record, exists := r.orders[orderUID]
+		if !exists || record.archived() {
+			continue
+		}
+		orders = append(orders, record.order.Clone())
+	}
+	return orders, nil
+}
+
+// DeleteOrder удаляет заказ
+func (r *MemoryRepository) DeleteOrder(ctx context.Context, orderUID string) error {
+	if err := ctx.Err(); err != nil {
+		return checkTimeout(ctx, "delete order", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.orders[orderUID]; !exists {
+		return fmt.Errorf("%w: %s", ErrNotFound, orderUID)
+	}
+	delete(r.orders, orderUID)
+
+	now := time.Now()
+	for uid, at := range r.deleted {
+		if now.Sub(at) > DeletionRetention {
+			delete(r.deleted, uid)
+		}
+	}
+	r.deleted[orderUID] = now
+	return nil
+}
+
+// ArchiveOrder помечает заказ удаленным, повторная архивация сохраняет исходное время
+func (r *MemoryRepository) ArchiveOrder(ctx context.Context, orderUID string) error {
+	if err := ctx.Err(); err != nil {
+		return checkTimeout(ctx, "archive order", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, exists := r.orders[orderUID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrNotFound, orderUID)
+	}
+	if !record.archived() {
+		// Записи не меняются на месте: копии уже отданы читателям
+		order := record.order.Clone()
+		now := time.Now()
+		order.DeletedAt = &now
+		record.order = order
+		r.orders[orderUID] = record
+	}
+	return nil
+}
+
+// DeletedOrderUIDs возвращает order_uid заказов, удаленных или архивированных не раньше since
+func (r *MemoryRepository) DeletedOrderUIDs(ctx context.Context, since time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, checkTimeout(ctx, "deleted orders", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var orderUIDs []string
+	for uid, at := range r.deleted {
+		if !at.Before(since) {
+			orderUIDs = append(orderUIDs, uid)
+		}
+	}
+	for uid, record := range r.orders {
+		if record.archived() && !record.order.DeletedAt.Before(since) {
+			orderUIDs = append(orderUIDs, uid)
+		}
+	}
+	return orderUIDs, nil
+}
+
+// GetAllOrders возвращает копии всех заказов от старых к новым
+func (r *MemoryRepository) GetAllOrders(ctx context.Context) ([]models.Order, error) {
+	var orders []models.Order
+	err := r.StreamOrders(ctx, StreamOptions{}, func(order *models.Order) error {
+		orders = append(orders, *order)
+		return nil
+	})
+	return orders, err
+}
+
+// StreamOrders передает fn копии заказов по порядку date_created, order_uid
+func (r *MemoryRepository) StreamOrders(ctx context.Context, opts StreamOptions, fn func(*models.Order) error) error {
+	records := r.sorted(func(a, b memoryRecord) bool {
+		if opts.NewestFirst {
+			return olderThan(b.order, a.order)
+		}
+		return olderThan(a.order, b.order)
+	})
+
+	for _, record := range records {
+		if record.archived() || record.createdAt.Before(opts.CreatedSince) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return checkTimeout(ctx, "stream orders", err)
+		}
+		if err := fn(record.order.Clone()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountOrders возвращает число заказов
+func (r *MemoryRepository) CountOrders(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, checkTimeout(ctx, "count orders", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	count := 0
+	for _, record := range r.orders {
+		if !record.archived() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ListOrders отбирает заказы перебором, новые первыми
+func (r *MemoryRepository) ListOrders(ctx context.Context, filter OrderFilter, cursor string, limit int) (OrderPage, error) {
+	if err := ctx.Err(); err != nil {
+		return OrderPage{}, checkTimeout(ctx, "list orders", err)
+	}
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return OrderPage{}, err
+	}
+	limit = listLimit(limit)
+
+	records := r.sorted(func(a, b memoryRecord) bool {
+		return olderThan(b.order, a.order)
+	})
+
+	page := OrderPage{Orders: []*models.Order{}}
+	for _, record := range records {
+		if (record.archived() && !filter.IncludeDeleted) ||
+			(after != nil && !after.follows(record.order)) || !filter.Match(record.order) {
+			continue
+		}
+		if len(page.Orders) == limit {
+			page.NextCursor = encodeCursor(page.Orders[limit-1])
+			break
+		}
+		page.Orders = append(page.Orders, record.order.Clone())
+	}
+	return page, nil
+}
+
+// SearchOrders ищет заказы перебором с упрощенным ранжированием
+func (r *MemoryRepository) SearchOrders(ctx context.Context, query string, page SearchPage) (SearchResults, error) {
+	if err := ctx.Err(); err != nil {
+		return SearchResults{}, checkTimeout(ctx, "search orders", err)
+	}
+	terms, err := searchTerms(query)
+	if err != nil {
+		return SearchResults{}, err
+	}
+
+	var found []SearchResult
+	for _, record := range r.sorted(func(a, b memoryRecord) bool { return a.order.OrderUID < b.order.OrderUID }) {
+		if record.archived() {
+			continue
+		}
+		if rank, ok := matchOrder(record.order, terms); ok {
+			found = append(found, SearchResult{Order: record.order, Rank: rank})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Rank > found[j].Rank
+	})
+
+	results := SearchResults{Results: []SearchResult{}}
+	limit := page.limit()
+	for i := max(page.Offset, 0); i < len(found); i++ {
+		if len(results.Results) == limit {
+			results.NextOffset = i
+			break
+		}
+		order := found[i].Order.Clone()
+		results.Results = append(results.Results, SearchResult{
+			Order:      order,
+			Rank:       found[i].Rank,
+			Highlights: highlight(order, terms),
+		})
+	}
+	return results, nil
+}
+
+// FindOrderUIDs ищет заказы по вторичному полю перебором, новые первыми
+func (r *MemoryRepository) FindOrderUIDs(ctx context.Context, field models.LookupField, value string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, checkTimeout(ctx, "find orders", err)
+	}
+	if !isLookupField(field) {
+		return nil, fmt.Errorf("unsupported lookup field: %s", field)
+	}
+
+	records := r.sorted(func(a, b memoryRecord) bool {
+		if !a.order.DateCreated.Equal(b.order.DateCreated) {
+			return a.order.DateCreated.After(b.order.DateCreated)
+		}
+		return a.order.OrderUID < b.order.OrderUID
+	})
+
+	var orderUIDs []string
+	for _, record := range records {
+		if record.archived() {
+			continue
+		}
+		for _, v := range record.order.LookupValues(field) {
+			if v == value {
+				orderUIDs = append(orderUIDs, record.order.OrderUID)
+				break
+			}
+		}
+		if len(orderUIDs) == maxLookupResults {
+			break
+		}
+	}
+	return orderUIDs, nil
+}
+
+// InitDB ничего не делает: хранилищу в памяти не нужна схема
+func (r *MemoryRepository) InitDB(ctx context.Context) error {
+	return nil
+}
+
+// Close ничего не делает, данные остаются доступны
+func (r *MemoryRepository) Close() {}
+
+// sorted возвращает записи, упорядоченные less
+func (r *MemoryRepository) sorted(less func(a, b memoryRecord) bool) []memoryRecord {
+	r.mu.RLock()
+	records := make([]memoryRecord, 0, len(r.orders))
+	for _, record := range r.orders {
+		records = append(records, record)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		return less(records[i], records[j])
+	})
+	return records
+}
+
+func (r memoryRecord) archived() bool {
+	return r.order.DeletedAt != nil
+}
+
+// storedCopy возвращает копию заказа для записи: DeletedAt из сообщения не принимается
+func storedCopy(order *models.Order) *models.Order {
+	stored := order.Clone()
+	stored.DeletedAt = nil
+	return stored
+}
+
+// olderThan сравнивает заказы как ORDER BY date_created, order_uid
+func olderThan(a, b *models.Order) bool {
+	if !a.DateCreated.Equal(b.DateCreated) {
+		return a.DateCreated.Before(b.DateCreated)
+	}
+	return a.OrderUID < b.OrderUID
+}
+
+func isLookupField(field models.LookupField) bool {
+	for _, f := range models.LookupFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryOutboxEvent - событие outbox с состоянием публикации
+type memoryOutboxEvent struct {
+	OutboxEvent
+	nextAttempt time.Time
+	sentAt      time.Time // нулевое - не отправлено
+	lastError   string
+}
+
+// ClaimOutboxEvents резервирует события на lease, соблюдая порядок событий заказа
+func (r *MemoryRepository) ClaimOutboxEvents(ctx context.Context, opts ClaimOptions) ([]OutboxEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, checkTimeout(ctx, "claim outbox events", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	blocked := make(map[string]bool) // у заказа есть более раннее неотправленное событие
+	var events []OutboxEvent
+	for _, event := range r.outbox {
+		if len(events) == opts.Limit {
+			break
+		}
+		if !event.sentAt.IsZero() || !strings.HasPrefix(event.OrderUID, opts.Prefix) {
+			continue
+		}
+		if blocked[event.OrderUID] {
+			continue
+		}
+		blocked[event.OrderUID] = true
+		if event.nextAttempt.After(now) {
+			continue
+		}
+
+		event.Attempts++
+		event.nextAttempt = now.Add(opts.Lease)
+		claimed := event.OutboxEvent
+		claimed.Payload = bytes.Clone(event.Payload)
+		events = append(events, claimed)
+	}
+	return events, nil
+}
+
+// MarkOutboxSent отмечает события отправленными
+func (r *MemoryRepository) MarkOutboxSent(ctx context.Context, ids []int64) error {
+	if err := ctx.Err(); err != nil {
+		return checkTimeout(ctx, "mark outbox sent", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sent := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		sent[id] = true
+	}
+	now := time.Now()
+	for _, event := range r.outbox {
+		if sent[event.ID] {
+			event.sentAt, event.lastError = now, ""
+		}
+	}
+	return nil
+}
+
+// MarkOutboxFailed откладывает следующую попытку публикации события
+func (r *MemoryRepository) MarkOutboxFailed(ctx context.Context, id int64, retryAt time.Time, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return checkTimeout(ctx, "mark outbox failed", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, event := range r.outbox {
+		if event.ID == id && event.sentAt.IsZero() {
+			event.nextAttempt, event.lastError = retryAt, reason
+		}
+	}
+	return nil
+}
+
+// DeleteSentOutboxEvents удаляет события, отправленные раньше before
+func (r *MemoryRepository) DeleteSentOutboxEvents(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, checkTimeout(ctx, "delete sent outbox events", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.outbox[:0]
+	for _, event := range r.outbox {
+		if event.sentAt.IsZero() || !event.sentAt.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	deleted := len(r.outbox) - len(kept)
+	clear(r.outbox[len(kept):])
+	r.outbox = kept
+	return deleted, nil
+}
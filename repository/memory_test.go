@@ -0,0 +1,13 @@
+package repository_test
+
+import (
+	"testing"
+	"wb-orders-service/repository"
+	"wb-orders-service/repository/repotest"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	repotest.Run(t, func() repository.OrderRepository {
+		return repository.NewMemoryRepository()
+	})
+}
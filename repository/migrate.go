@@ -0,0 +1,311 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"wb-orders-service/logging"
+)
+
+// Миграции схемы: migrations/NNNN_name.up.sql и парный NNNN_name.down.sql.
+// Каждая миграция выполняется в своей транзакции вместе с записью в schema_migrations.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Ключ advisory lock, под которым выполняются миграции: экземпляры,
+// стартующие одновременно, применяют их по очереди
+const migrationLockKey int64 = 0x77626f7264657273 // "wborders"
+
+// Migration - одна версия схемы
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus - состояние версии схемы в БД
+type MigrationStatus struct {
+	Version   int
+	Name      string // пусто, если версия применена, но неизвестна этой сборке
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations возвращает встроенные миграции по возрастанию версии
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		base, direction, ok := cutDirection(entry.Name())
+		if !ok {
+			return nil, fmt.Errorf("bad migration file name %q, want NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		versionStr, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("bad migration version in %q", entry.Name())
+		}
+
+		body, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", entry.Name(), err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has different names: %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func cutDirection(fileName string) (base, direction string, ok bool) {
+	if base, ok := strings.CutSuffix(fileName, ".up.sql"); ok {
+		return base, "up", true
+	}
+	if base, ok := strings.CutSuffix(fileName, ".down.sql"); ok {
+		return base, "down", true
+	}
+	return "", "", false
+}
+
+// InitDB применяет все еще не примененные миграции схемы
+func (r *PostgresRepository) InitDB(ctx context.Context) error {
+	return r.Migrate(ctx)
+}
+
+// Migrate применяет все еще не примененные миграции. Версии, которые уже есть
+// в БД, но неизвестны этой сборке (база обновлена более новой версией сервиса),
+// не откатываются - только пишутся в лог.
+func (r *PostgresRepository) Migrate(ctx context.Context) error {
+	return r.withMigrationLock(ctx, func(conn *sql.Conn, migrations []Migration, applied map[int]time.Time) error {
+		known := make(map[int]bool, len(migrations))
+		for _, m := range migrations {
+			known[m.Version] = true
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, m, true); err != nil {
+				return err
+			}
+		}
+
+		for version := range applied {
+			if !known[version] {
+				logging.Warnf("Database has schema version %d unknown to this build", version)
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateTo приводит схему к версии target: применяет миграции до нее
+// и откатывает более новые. target = 0 откатывает все миграции.
+func (r *PostgresRepository) MigrateTo(ctx context.Context, target int) error {
+	return r.withMigrationLock(ctx, func(conn *sql.Conn, migrations []Migration, applied map[int]time.Time) error {
+		known := make(map[int]bool, len(migrations))
+		for _, m := range migrations {
+			known[m.Version] = true
+		}
+		if target != 0 && !known[target] {
+			return fmt.Errorf("unknown schema version %d", target)
+		}
+		for version := range applied {
+			if version > target && !known[version] {
+				return fmt.Errorf("cannot roll back schema version %d: migration is unknown to this build", version)
+			}
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; !ok && m.Version <= target {
+				if err := runMigration(ctx, conn, m, true); err != nil {
+					return err
+				}
+			}
+		}
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; ok && m.Version > target {
+				if err := runMigration(ctx, conn, m, false); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown откатывает последнюю примененную миграцию
+func (r *PostgresRepository) MigrateDown(ctx context.Context) error {
+	return r.withMigrationLock(ctx, func(conn *sql.Conn, migrations []Migration, applied map[int]time.Time) error {
+		latest := 0
+		for version := range applied {
+			latest = max(latest, version)
+		}
+		if latest == 0 {
+			logging.Infof("No schema migrations to roll back")
+			return nil
+		}
+
+		for _, m := range migrations {
+			if m.Version == latest {
+				return runMigration(ctx, conn, m, false)
+			}
+		}
+		return fmt.Errorf("cannot roll back schema version %d: migration is unknown to this build", latest)
+	})
+}
+
+// MigrationStatus возвращает все известные миграции и примененные версии по возрастанию
+func (r *PostgresRepository) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	var status []MigrationStatus
+	err := r.withMigrationLock(ctx, func(conn *sql.Conn, migrations []Migration, applied map[int]time.Time) error {
+		known := make(map[int]bool, len(migrations))
+		for _, m := range migrations {
+			known[m.Version] = true
+			appliedAt, ok := applied[m.Version]
+			status = append(status, MigrationStatus{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: appliedAt})
+		}
+		for version, appliedAt := range applied {
+			if !known[version] {
+				status = append(status, MigrationStatus{Version: version, Applied: true, AppliedAt: appliedAt})
+			}
+		}
+		return nil
+	})
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+	return status, err
+}
+
+// withMigrationLock выполняет fn на одном соединении под advisory lock,
+// передавая встроенные миграции и уже примененные версии
+func (r *PostgresRepository) withMigrationLock(ctx context.Context, fn func(*sql.Conn, []Migration, map[int]time.Time) error) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	// Advisory lock уровня сессии: блокировка, запросы и разблокировка
+	// должны идти через одно соединение пула
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %v", err)
+	}
+	defer func() {
+		// Не через ctx: после его отмены блокировка осталась бы на соединении,
+		// вернувшемся в пул. Если снять ее не удалось, соединение закрывается.
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey); err != nil {
+			logging.Warnf("Failed to release migration lock: %v", err)
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return fmt.Errorf("failed to get applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return fmt.Errorf("failed to scan migration: %v", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating migrations: %v", err)
+	}
+	rows.Close()
+
+	return fn(conn, migrations, applied)
+}
+
+// runMigration применяет (up) или откатывает миграцию в одной транзакции с записью о ней
+func runMigration(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	// После Commit ничего не делает
+	defer tx.Rollback()
+
+	direction, body := "down", m.Down
+	if up {
+		direction, body = "up", m.Up
+	}
+
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return fmt.Errorf("failed to apply migration %04d_%s (%s): %v", m.Version, m.Name, direction, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %04d_%s: %v", m.Version, m.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %04d_%s: %v", m.Version, m.Name, err)
+	}
+
+	if up {
+		logging.Infof("Migration %04d_%s applied", m.Version, m.Name)
+	} else {
+		logging.Infof("Migration %04d_%s rolled back", m.Version, m.Name)
+	}
+	return nil
+}
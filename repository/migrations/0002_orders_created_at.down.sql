@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS orders_created_at_idx;
+ALTER TABLE orders DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,4 @@
+-- Время записи заказа в БД (в отличие от date_created из сообщения),
+-- по нему кэш догружает заказы, не попавшие в снимок
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+CREATE INDEX IF NOT EXISTS orders_created_at_idx ON orders (created_at);
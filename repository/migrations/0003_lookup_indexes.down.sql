@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS items_chrt_id_idx;
+DROP INDEX IF EXISTS items_rid_idx;
+DROP INDEX IF EXISTS items_track_number_idx;
+DROP INDEX IF EXISTS items_order_uid_idx;
+DROP INDEX IF EXISTS orders_customer_id_idx;
+DROP INDEX IF EXISTS orders_track_number_idx;
+DROP INDEX IF EXISTS orders_date_created_idx;
@@ -0,0 +1,10 @@
+-- Порядок и курсор StreamOrders
+CREATE INDEX IF NOT EXISTS orders_date_created_idx ON orders (date_created, order_uid);
+
+-- Поиск по вторичным полям, когда заказа нет в кэше
+CREATE INDEX IF NOT EXISTS orders_track_number_idx ON orders (track_number);
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id);
+CREATE INDEX IF NOT EXISTS items_order_uid_idx ON items (order_uid);
+CREATE INDEX IF NOT EXISTS items_track_number_idx ON items (track_number);
+CREATE INDEX IF NOT EXISTS items_rid_idx ON items (rid);
+CREATE INDEX IF NOT EXISTS items_chrt_id_idx ON items (chrt_id);
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS items_brand_idx;
+DROP INDEX IF EXISTS payments_amount_idx;
+DROP INDEX IF EXISTS payments_currency_idx;
+DROP INDEX IF EXISTS payments_bank_idx;
+DROP INDEX IF EXISTS payments_provider_idx;
+
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id);
+
+DROP INDEX IF EXISTS orders_entry_created_idx;
+DROP INDEX IF EXISTS orders_locale_created_idx;
+DROP INDEX IF EXISTS orders_delivery_service_created_idx;
+DROP INDEX IF EXISTS orders_customer_id_created_idx;
@@ -0,0 +1,16 @@
+-- Фильтры ListOrders по полям заказа: равенство плюс порядок страницы
+-- (date_created, order_uid), чтобы страница читалась по индексу без сортировки
+CREATE INDEX IF NOT EXISTS orders_customer_id_created_idx ON orders (customer_id, date_created, order_uid);
+CREATE INDEX IF NOT EXISTS orders_delivery_service_created_idx ON orders (delivery_service, date_created, order_uid);
+CREATE INDEX IF NOT EXISTS orders_locale_created_idx ON orders (locale, date_created, order_uid);
+CREATE INDEX IF NOT EXISTS orders_entry_created_idx ON orders (entry, date_created, order_uid);
+
+-- Составной индекс покрывает поиск по customer_id из 0003
+DROP INDEX IF EXISTS orders_customer_id_idx;
+
+-- Фильтры по платежу и товарам
+CREATE INDEX IF NOT EXISTS payments_provider_idx ON payments (provider);
+CREATE INDEX IF NOT EXISTS payments_bank_idx ON payments (bank);
+CREATE INDEX IF NOT EXISTS payments_currency_idx ON payments (currency);
+CREATE INDEX IF NOT EXISTS payments_amount_idx ON payments (amount);
+CREATE INDEX IF NOT EXISTS items_brand_idx ON items (brand, order_uid);
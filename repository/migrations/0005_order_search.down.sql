@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS order_search;
+DROP FUNCTION IF EXISTS order_search_document(VARCHAR);
@@ -0,0 +1,22 @@
+-- Полнотекстовый поиск: документ заказа из названий и брендов товаров (вес A)
+-- и имени, города и адреса доставки (вес B). Конфигурация simple без стемминга:
+-- в полях в основном имена собственные на разных языках.
+CREATE OR REPLACE FUNCTION order_search_document(uid VARCHAR) RETURNS tsvector
+LANGUAGE sql STABLE AS $$
+    SELECT setweight(to_tsvector('simple', coalesce(
+               (SELECT string_agg(concat_ws(' ', name, brand), ' ') FROM items WHERE order_uid = uid), '')), 'A')
+        || setweight(to_tsvector('simple', coalesce(
+               (SELECT concat_ws(' ', name, city, address) FROM deliveries WHERE order_uid = uid), '')), 'B')
+$$;
+
+-- Документ пишется в одной транзакции с заказом, удаляется вместе с ним
+CREATE TABLE IF NOT EXISTS order_search (
+    order_uid VARCHAR(255) PRIMARY KEY REFERENCES orders(order_uid) ON DELETE CASCADE,
+    document tsvector NOT NULL
+);
+
+INSERT INTO order_search (order_uid, document)
+SELECT order_uid, order_search_document(order_uid) FROM orders
+ON CONFLICT (order_uid) DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS order_search_document_idx ON order_search USING GIN (document);
@@ -0,0 +1,42 @@
+-- История версий заказа: каждая запись заказа (вставка, замена, UpdateOrder)
+-- добавляет версию с данными заказа и исходным сообщением
+CREATE TABLE IF NOT EXISTS order_revisions (
+    order_uid VARCHAR(255) NOT NULL REFERENCES orders(order_uid) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    source VARCHAR(50) NOT NULL DEFAULT '',
+    data JSONB NOT NULL,
+    message JSONB,
+    PRIMARY KEY (order_uid, version)
+);
+
+-- Версия 1 для уже сохраненных заказов: данные в том же JSON, что и models.Order
+INSERT INTO order_revisions (order_uid, version, created_at, data)
+SELECT o.order_uid, 1, o.created_at, jsonb_build_object(
+    'order_uid', o.order_uid,
+    'track_number', o.track_number,
+    'entry', o.entry,
+    'delivery', (SELECT jsonb_build_object(
+        'name', d.name, 'phone', d.phone, 'zip', d.zip, 'city', d.city,
+        'address', d.address, 'region', d.region, 'email', d.email)
+        FROM deliveries d WHERE d.order_uid = o.order_uid),
+    'payment', (SELECT jsonb_build_object(
+        'transaction', p.transaction, 'request_id', p.request_id, 'currency', p.currency,
+        'provider', p.provider, 'amount', p.amount, 'payment_dt', p.payment_dt, 'bank', p.bank,
+        'delivery_cost', p.delivery_cost, 'goods_total', p.goods_total, 'custom_fee', p.custom_fee)
+        FROM payments p WHERE p.transaction = o.order_uid),
+    'items', coalesce((SELECT jsonb_agg(jsonb_build_object(
+        'chrt_id', i.chrt_id, 'track_number', i.track_number, 'price', i.price, 'rid', i.rid,
+        'name', i.name, 'sale', i.sale, 'size', i.size, 'total_price', i.total_price,
+        'nm_id', i.nm_id, 'brand', i.brand, 'status', i.status) ORDER BY i.id)
+        FROM items i WHERE i.order_uid = o.order_uid), '[]'::jsonb),
+    'locale', o.locale,
+    'internal_signature', o.internal_signature,
+    'customer_id', o.customer_id,
+    'delivery_service', o.delivery_service,
+    'shardkey', o.shardkey,
+    'sm_id', o.sm_id,
+    'date_created', o.date_created,
+    'oof_shard', o.oof_shard)
+FROM orders o
+ON CONFLICT (order_uid, version) DO NOTHING;
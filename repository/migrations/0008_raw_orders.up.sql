@@ -0,0 +1,19 @@
+-- Исходное сообщение, из которого записан заказ: поля, которых нет в models.Order,
+-- не теряются, и нормализованные таблицы можно пересобрать (main rederive)
+CREATE TABLE IF NOT EXISTS raw_orders (
+    order_uid VARCHAR(255) PRIMARY KEY REFERENCES orders(order_uid) ON DELETE CASCADE,
+    payload JSONB NOT NULL,
+    nats_sequence BIGINT,
+    nats_timestamp TIMESTAMP WITH TIME ZONE,
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+-- Сообщения уже есть в истории, если последняя версия заказа записана из сообщения
+INSERT INTO raw_orders (order_uid, payload, received_at)
+SELECT order_uid, message, created_at FROM (
+    SELECT DISTINCT ON (order_uid) order_uid, message, created_at
+    FROM order_revisions
+    ORDER BY order_uid, version DESC
+) latest
+WHERE message IS NOT NULL
+ON CONFLICT (order_uid) DO NOTHING;
@@ -0,0 +1,21 @@
+-- События о заказах для публикации (transactional outbox): пишутся в одной
+-- транзакции с заказом, публикует их outbox.Relay. Внешнего ключа нет -
+-- событие переживает удаление заказа.
+CREATE TABLE IF NOT EXISTS order_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    order_uid VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    last_error TEXT,
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Выборка неотправленных событий и проверка порядка событий заказа
+CREATE INDEX IF NOT EXISTS order_outbox_pending_idx ON order_outbox (next_attempt_at, id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS order_outbox_order_pending_idx ON order_outbox (order_uid, id) WHERE sent_at IS NULL;
+-- Удаление старых отправленных событий
+CREATE INDEX IF NOT EXISTS order_outbox_sent_at_idx ON order_outbox (sent_at) WHERE sent_at IS NOT NULL;
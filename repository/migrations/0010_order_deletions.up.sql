@@ -0,0 +1,8 @@
+-- Журнал удаленных заказов: по нему кэш, восстановленный из снимка, убирает
+-- заказы, удаленные после снимка. Записи старше DeletionRetention удаляет DeleteOrder.
+CREATE TABLE IF NOT EXISTS order_deletions (
+    order_uid VARCHAR(255) NOT NULL,
+    deleted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS order_deletions_deleted_at_idx ON order_deletions (deleted_at);
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"wb-orders-service/models"
+)
+
+// Типы событий о заказах
+const (
+	EventOrderCreated = "order.created"
+	EventOrderUpdated = "order.updated"
+)
+
+// OrderEvent - публикуемое событие о заказе. Пара order_uid, version
+// уникальна: по ней получатели отбрасывают повторы.
+type OrderEvent struct {
+	Type       string        `json:"type"`
+	OrderUID   string        `json:"order_uid"`
+	Version    int           `json:"version"`
+	OccurredAt time.Time     `json:"occurred_at"`
+	Order      *models.Order `json:"order"`
+}
+
+// OutboxEvent - запись outbox, ожидающая публикации
+type OutboxEvent struct {
+	ID        int64
+	Type      string
+	OrderUID  string
+	Version   int
+	Payload   json.RawMessage // OrderEvent в JSON
+	CreatedAt time.Time
+	Attempts  int // попыток публикации, включая текущую
+}
+
+// ClaimOptions - параметры ClaimOutboxEvents
+type ClaimOptions struct {
+	Limit  int
+	Lease  time.Duration
+	Prefix string // только заказы с этим префиксом order_uid, пусто - все
+}
+
+// OutboxStore - хранилище событий outbox. События пишут SaveOrder и UpdateOrder
+// в одной транзакции с заказом, публикует их outbox.Relay.
+type OutboxStore interface {
+	// ClaimOutboxEvents резервирует до opts.Limit неотправленных событий на opts.Lease:
+	// за это время другие экземпляры их не получат. Событие заказа выдается,
+	// только когда отправлены все его более ранние события.
+	ClaimOutboxEvents(ctx context.Context, opts ClaimOptions) ([]OutboxEvent, error)
+	// MarkOutboxSent отмечает события отправленными
+	MarkOutboxSent(ctx context.Context, ids []int64) error
+	// MarkOutboxFailed откладывает следующую попытку публикации до retryAt
+	MarkOutboxFailed(ctx context.Context, id int64, retryAt time.Time, reason string) error
+	// DeleteSentOutboxEvents удаляет события, отправленные раньше before
+	DeleteSentOutboxEvents(ctx context.Context, before time.Time) (int, error)
+}
+
+// orderEventPayload возвращает JSON события о записанной версии заказа
+func orderEventPayload(eventType string, order *models.Order, version int) ([]byte, error) {
+	payload, err := json.Marshal(OrderEvent{
+		Type:       eventType,
+		OrderUID:   order.OrderUID,
+		Version:    version,
+		OccurredAt: time.Now().UTC(),
+		Order:      revisionOrder(order),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal order event: %v", err)
+	}
+	return payload, nil
+}
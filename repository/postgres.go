@@ -1,176 +1,1068 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"log"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"wb-orders-service/logging"
 	"wb-orders-service/models"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// PostgresRepository - хранилище заказов в PostgreSQL
 type PostgresRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts atomic.Pointer[Timeouts]
 }
 
-func NewPostgresRepository(connStr string) (*PostgresRepository, error) {
-	db, err := sql.Open("postgres", connStr)
+// SetTimeouts задает дедлайны операций, действует на операции, начатые после вызова
+func (r *PostgresRepository) SetTimeouts(timeouts Timeouts) {
+	r.timeouts.Store(&timeouts)
+}
+
+func (r *PostgresRepository) Close() {
+	r.db.Close()
+}
+
+// querier - общие методы *sql.DB и *sql.Tx для чтения заказа
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// SaveOrder сохраняет заказ в БД (транзакционно). Занятость order_uid проверяется
+// по первичному ключу внутри транзакции (INSERT ... ON CONFLICT DO NOTHING),
+// поэтому одновременные доставки одного сообщения не приводят к гонке:
+// вторая дожидается первой и видит уже сохраненный заказ.
+func (r *PostgresRepository) SaveOrder(ctx context.Context, order *models.Order, opts SaveOptions) (SaveResult, error) {
+	source, err := newRevisionSource(opts)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Write)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, checkTimeout(ctx, "save order", fmt.Errorf("failed to begin transaction: %v", err))
+	}
+	// После Commit ничего не делает
+	defer tx.Rollback()
+
+	result, err := saveOrderTx(ctx, tx, order, opts.Policy, source)
+	if err != nil {
+		return 0, checkTimeout(ctx, "save order", err)
+	}
+
+	// Коммитим транзакцию
+	if err = tx.Commit(); err != nil {
+		return 0, checkTimeout(ctx, "save order", fmt.Errorf("failed to commit transaction: %v", err))
+	}
+
+	logging.Debugf("Order %s saved: %s", order.OrderUID, result)
+	return result, nil
+}
+
+func saveOrderTx(ctx context.Context, tx *sql.Tx, order *models.Order, policy SavePolicy, source revisionSource) (SaveResult, error) {
+	// PostgreSQL хранит время с точностью до микросекунды
+	stored := order.Clone()
+	stored.DateCreated = stored.DateCreated.Round(time.Microsecond)
+
+	// Вставляем в таблицу orders, если order_uid свободен
+	orderQuery := `INSERT INTO orders (
+		order_uid, track_number, entry, locale, internal_signature,
+		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	ON CONFLICT (order_uid) DO NOTHING`
+
+	res, err := tx.ExecContext(ctx, orderQuery,
+		order.OrderUID,
+		order.TrackNumber,
+		order.Entry,
+		order.Locale,
+		order.InternalSignature,
+		order.CustomerID,
+		order.DeliveryService,
+		order.Shardkey,
+		order.SmID,
+		order.DateCreated,
+		order.OofShard,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert order: %v", err)
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert order: %v", err)
 	}
+	if inserted == 1 {
+		if err := insertOrderChildren(ctx, tx, order); err != nil {
+			return 0, err
+		}
+		_, err := recordWrite(ctx, tx, stored, source, EventOrderCreated)
+		return SaveInserted, err
+	}
+
+	// Заказ уже есть: блокируем его до конца транзакции и сравниваем
+	existing, err := getOrder(ctx, tx, order.OrderUID, true)
+	if err != nil {
+		return 0, err
+	}
+
+	result, write, err := resolveExisting(existing, stored, policy)
+	if result == SaveDuplicate {
+		// Повторная доставка дополняет заказы, записанные до появления raw_orders
+		return result, saveRaw(ctx, tx, order.OrderUID, source, false)
+	}
+	if err != nil || !write {
+		return result, err
+	}
+
+	if err := replaceOrderTx(ctx, tx, order); err != nil {
+		return 0, err
+	}
+	_, err = recordWrite(ctx, tx, stored, source, EventOrderUpdated)
+	return SaveReplaced, err
+}
+
+// replaceOrderTx заменяет сохраненный заказ целиком
+func replaceOrderTx(ctx context.Context, tx *sql.Tx, order *models.Order) error {
+	// Заменяем заказ целиком: дочерние записи удаляются и вставляются заново.
+	// created_at обновляется, чтобы замена попала в догрузку после снимка кэша;
+	// архивный заказ замена возвращает из архива.
+	for _, query := range []string{
+		`DELETE FROM items WHERE order_uid = $1`,
+		`DELETE FROM deliveries WHERE order_uid = $1`,
+		`DELETE FROM payments WHERE transaction = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, order.OrderUID); err != nil {
+			return fmt.Errorf("failed to delete order children: %v", err)
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE orders SET
+		track_number = $2, entry = $3, locale = $4, internal_signature = $5,
+		customer_id = $6, delivery_service = $7, shardkey = $8, sm_id = $9,
+		date_created = $10, oof_shard = $11, created_at = now(), deleted_at = NULL
+	WHERE order_uid = $1`,
+		order.OrderUID,
+		order.TrackNumber,
+		order.Entry,
+		order.Locale,
+		order.InternalSignature,
+		order.CustomerID,
+		order.DeliveryService,
+		order.Shardkey,
+		order.SmID,
+		order.DateCreated,
+		order.OofShard,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update order: %v", err)
+	}
+
+	return insertOrderChildren(ctx, tx, order)
+}
+
+// insertOrderChildren вставляет доставку, платеж и товары заказа
+func insertOrderChildren(ctx context.Context, tx *sql.Tx, order *models.Order) error {
+	// Вставляем в таблицу deliveries
+	deliveryQuery := `INSERT INTO deliveries (
+		order_uid, name, phone, zip, city, address, region, email
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err := tx.ExecContext(ctx, deliveryQuery,
+		order.OrderUID,
+		order.Delivery.Name,
+		order.Delivery.Phone,
+		order.Delivery.Zip,
+		order.Delivery.City,
+		order.Delivery.Address,
+		order.Delivery.Region,
+		order.Delivery.Email,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert delivery: %v", err)
+	}
+
+	// Вставляем в таблицу payments
+	paymentQuery := `INSERT INTO payments (
+		transaction, request_id, currency, provider, amount, 
+		payment_dt, bank, delivery_cost, goods_total, custom_fee
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
 
-	if err = db.Ping(); err != nil {
+	_, err = tx.ExecContext(ctx, paymentQuery,
+		order.Payment.Transaction,
+		order.Payment.RequestID,
+		order.Payment.Currency,
+		order.Payment.Provider,
+		order.Payment.Amount,
+		order.Payment.PaymentDt,
+		order.Payment.Bank,
+		order.Payment.DeliveryCost,
+		order.Payment.GoodsTotal,
+		order.Payment.CustomFee,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert payment: %v", err)
+	}
+
+	// Вставляем все items
+	itemQuery := `INSERT INTO items (
+		order_uid, chrt_id, track_number, price, rid, name, 
+		sale, size, total_price, nm_id, brand, status
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	for _, item := range order.Items {
+		_, err = tx.ExecContext(ctx, itemQuery,
+			order.OrderUID,
+			item.ChrtID,
+			item.TrackNumber,
+			item.Price,
+			item.Rid,
+			item.Name,
+			item.Sale,
+			item.Size,
+			item.TotalPrice,
+			item.NmID,
+			item.Brand,
+			item.Status,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert item: %v", err)
+		}
+	}
+
+	// Поисковый документ собирается из только что вставленных товаров и доставки
+	_, err = tx.ExecContext(ctx, `INSERT INTO order_search (order_uid, document)
+		VALUES ($1, order_search_document($1))
+		ON CONFLICT (order_uid) DO UPDATE SET document = EXCLUDED.document`, order.OrderUID)
+	if err != nil {
+		return fmt.Errorf("failed to index order for search: %v", err)
+	}
+
+	return nil
+}
+
+// SaveOrdersBatch сохраняет пачку новых заказов в одной транзакции. Заказы
+// загружаются командой COPY во временную таблицу и переносятся в orders
+// с ON CONFLICT DO NOTHING: занятые order_uid (в том числе занятые параллельно)
+// не прерывают пачку, а сравниваются с сохраненными заказами. Доставки, платежи,
+// товары, версии, raw_orders и события outbox новых заказов загружаются через COPY.
+func (r *PostgresRepository) SaveOrdersBatch(ctx context.Context, batch []BatchOrder, opts BatchOptions) (BatchResult, error) {
+	var result BatchResult
+	entries := prepareBatch(batch, opts, &result)
+	if len(entries) == 0 {
+		result.sortRejected()
+		return result, nil
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Write)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return BatchResult{}, checkTimeout(ctx, "save orders batch", fmt.Errorf("failed to begin transaction: %v", err))
+	}
+	defer tx.Rollback()
+
+	// PostgreSQL хранит время с точностью до микросекунды
+	for i := range entries {
+		stored := entries[i].order.Clone()
+		stored.DateCreated = stored.DateCreated.Round(time.Microsecond)
+		entries[i].order = stored
+	}
+
+	inserted, err := insertBatchOrders(ctx, tx, entries)
+	if err != nil {
+		return BatchResult{}, checkTimeout(ctx, "save orders batch", err)
+	}
+	var fresh, existing []batchEntry
+	for _, entry := range entries {
+		if inserted[entry.order.OrderUID] {
+			fresh = append(fresh, entry)
+		} else {
+			existing = append(existing, entry)
+		}
+	}
+
+	if err := copyBatchChildren(ctx, tx, fresh); err != nil {
+		return BatchResult{}, checkTimeout(ctx, "save orders batch", err)
+	}
+	if err := resolveBatchExisting(ctx, tx, existing, &result); err != nil {
+		return BatchResult{}, checkTimeout(ctx, "save orders batch", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return BatchResult{}, checkTimeout(ctx, "save orders batch", fmt.Errorf("failed to commit transaction: %v", err))
+	}
+
+	result.Inserted = len(fresh)
+	result.sortRejected()
+	logging.Debugf("Orders batch saved: %d inserted, %d duplicates, %d rejected",
+		result.Inserted, result.Duplicates, len(result.Rejected))
+	return result, nil
+}
+
+// insertBatchOrders записывает строки orders пачки и возвращает order_uid вставленных
+func insertBatchOrders(ctx context.Context, tx *sql.Tx, entries []batchEntry) (map[string]bool, error) {
+	// Временная таблица удаляется при завершении транзакции
+	_, err := tx.ExecContext(ctx, `CREATE TEMP TABLE batch_orders
+		(LIKE orders INCLUDING DEFAULTS) ON COMMIT DROP`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch table: %v", err)
+	}
+
+	rows := make([][]any, len(entries))
+	for i, entry := range entries {
+		order := entry.order
+		rows[i] = []any{
+			order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+			order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
+		}
+	}
+	err = copyRows(ctx, tx, "batch_orders", []string{
+		"order_uid", "track_number", "entry", "locale", "internal_signature",
+		"customer_id", "delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
+	}, rows)
+	if err != nil {
 		return nil, err
 	}
-
-	return &PostgresRepository{db: db}, nil
+
+	result, err := tx.QueryContext(ctx, `INSERT INTO orders (
+		order_uid, track_number, entry, locale, internal_signature,
+		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+	)
+	SELECT order_uid, track_number, entry, locale, internal_signature,
+		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+	FROM batch_orders
+	ON CONFLICT (order_uid) DO NOTHING
+	RETURNING order_uid`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert orders: %v", err)
+	}
+	defer result.Close()
+
+	inserted := make(map[string]bool, len(entries))
+	for result.Next() {
+		var orderUID string
+		if err := result.Scan(&orderUID); err != nil {
+			return nil, fmt.Errorf("failed to scan inserted order: %v", err)
+		}
+		inserted[orderUID] = true
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to insert orders: %v", err)
+	}
+	return inserted, nil
+}
+
+// copyBatchChildren загружает дочерние записи, первую версию, исходное
+// сообщение и событие order.created только что вставленных заказов
+func copyBatchChildren(ctx context.Context, tx *sql.Tx, entries []batchEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var deliveries, payments, items, revisions, raws, events [][]any
+	orderUIDs := make([]string, len(entries))
+	for i, entry := range entries {
+		order := entry.order
+		orderUIDs[i] = order.OrderUID
+
+		d := order.Delivery
+		deliveries = append(deliveries, []any{order.OrderUID, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email})
+		p := order.Payment
+		payments = append(payments, []any{p.Transaction, p.RequestID, p.Currency, p.Provider, p.Amount,
+			p.PaymentDt, p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee})
+		for _, item := range order.Items {
+			items = append(items, []any{order.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name,
+				item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status})
+		}
+
+		// Заказ только что вставлен: его история пуста, версия - первая.
+		// JSON передается строкой: COPY записал бы []byte как bytea.
+		data, err := json.Marshal(revisionOrder(order))
+		if err != nil {
+			return fmt.Errorf("failed to marshal order revision: %v", err)
+		}
+		var message any
+		if entry.source.message != nil {
+			message = string(entry.source.message)
+		}
+		revisions = append(revisions, []any{order.OrderUID, 1, entry.source.name, string(data), message})
+
+		if raw := entry.source.raw(order.OrderUID); raw != nil {
+			var sequence, timestamp any
+			if raw.Sequence != 0 {
+				sequence = int64(raw.Sequence)
+			}
+			if !raw.Timestamp.IsZero() {
+				timestamp = raw.Timestamp
+			}
+			raws = append(raws, []any{raw.OrderUID, string(raw.Payload), sequence, timestamp})
+		}
+
+		payload, err := orderEventPayload(EventOrderCreated, order, 1)
+		if err != nil {
+			return err
+		}
+		events = append(events, []any{EventOrderCreated, order.OrderUID, 1, string(payload)})
+	}
+
+	copies := []struct {
+		table   string
+		columns []string
+		rows    [][]any
+	}{
+		{"deliveries", []string{"order_uid", "name", "phone", "zip", "city", "address", "region", "email"}, deliveries},
+		{"payments", []string{"transaction", "request_id", "currency", "provider", "amount",
+			"payment_dt", "bank", "delivery_cost", "goods_total", "custom_fee"}, payments},
+		{"items", []string{"order_uid", "chrt_id", "track_number", "price", "rid", "name",
+			"sale", "size", "total_price", "nm_id", "brand", "status"}, items},
+		{"order_revisions", []string{"order_uid", "version", "source", "data", "message"}, revisions},
+		{"raw_orders", []string{"order_uid", "payload", "nats_sequence", "nats_timestamp"}, raws},
+		{"order_outbox", []string{"event_type", "order_uid", "version", "payload"}, events},
+	}
+	for _, c := range copies {
+		if err := copyRows(ctx, tx, c.table, c.columns, c.rows); err != nil {
+			return err
+		}
+	}
+
+	// Поисковые документы собираются из загруженных товаров и доставок
+	_, err := tx.ExecContext(ctx, `INSERT INTO order_search (order_uid, document)
+		SELECT uid, order_search_document(uid) FROM unnest($1::varchar[]) AS uid`, pq.Array(orderUIDs))
+	if err != nil {
+		return fmt.Errorf("failed to index orders for search: %v", err)
+	}
+	return nil
+}
+
+// resolveBatchExisting сравнивает заказы пачки с уже сохраненными под теми же
+// order_uid: совпадающие - дубликаты, остальные отклоняются как конфликт
+func resolveBatchExisting(ctx context.Context, tx *sql.Tx, entries []batchEntry, result *BatchResult) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	orderUIDs := make([]string, len(entries))
+	for i, entry := range entries {
+		orderUIDs[i] = entry.order.OrderUID
+	}
+	orders, err := loadOrderBatch(ctx, tx, selectOrdersQuery+"\n\tWHERE o.order_uid = ANY($1)", pq.Array(orderUIDs))
+	if err == nil {
+		err = loadBatchItems(ctx, tx, orders)
+	}
+	if err != nil {
+		return err
+	}
+	saved := make(map[string]*models.Order, len(orders))
+	for _, order := range orders {
+		saved[order.OrderUID] = order
+	}
+
+	for _, entry := range entries {
+		uid := entry.order.OrderUID
+		// Заказ удален параллельно после попытки вставки
+		existing, ok := saved[uid]
+		if !ok {
+			result.reject(entry.index, uid, fmt.Errorf("%w: %s changed concurrently", ErrConflict, uid))
+			continue
+		}
+		if _, _, err := resolveExisting(existing, entry.order, SaveReject); err != nil {
+			result.reject(entry.index, uid, err)
+			continue
+		}
+		result.Duplicates++
+		// Как и повторная доставка, дополняет заказы, записанные до появления raw_orders
+		if err := saveRaw(ctx, tx, uid, entry.source, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyRows загружает строки в table командой COPY
+func copyRows(ctx context.Context, tx *sql.Tx, table string, columns []string, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return fmt.Errorf("failed to start copy into %s: %v", table, err)
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return fmt.Errorf("failed to copy into %s: %v", table, err)
+		}
+	}
+	// Exec без аргументов завершает COPY
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("failed to copy into %s: %v", table, err)
+	}
+	return nil
+}
+
+// GetOrderByUID возвращает заказ по его UID
+func (r *PostgresRepository) GetOrderByUID(ctx context.Context, orderUID string, opts ReadOptions) (*models.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Read)
+	defer cancel()
+
+	order, err := getOrder(ctx, r.db, orderUID, false)
+	if err != nil {
+		return nil, checkTimeout(ctx, "get order", err)
+	}
+	if order.DeletedAt != nil && !opts.IncludeDeleted {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, orderUID)
+	}
+	return order, nil
+}
+
+// GetOrdersByUIDs загружает заказы одним запросом заказов с доставкой и платежом
+// и одним запросом товаров, затем раскладывает их в порядке orderUIDs
+func (r *PostgresRepository) GetOrdersByUIDs(ctx context.Context, orderUIDs []string) ([]*models.Order, error) {
+	if len(orderUIDs) == 0 {
+		return []*models.Order{}, nil
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Read)
+	defer cancel()
+
+	loaded, err := loadOrderBatch(ctx, r.db, selectOrdersQuery+"\n\tWHERE o.order_uid = ANY($1) AND o.deleted_at IS NULL", pq.Array(orderUIDs))
+	if err == nil && len(loaded) > 0 {
+		err = loadBatchItems(ctx, r.db, loaded)
+	}
+	if err != nil {
+		return nil, checkTimeout(ctx, "get orders", err)
+	}
+
+	byUID := make(map[string]*models.Order, len(loaded))
+	for _, order := range loaded {
+		byUID[order.OrderUID] = order
+	}
+	orders := make([]*models.Order, 0, len(loaded))
+	for _, orderUID := range orderUIDs {
+		if order, ok := byUID[orderUID]; ok {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// DeleteOrder удаляет заказ; доставка, платеж, товары и поисковый документ
+// удаляются каскадно (ON DELETE CASCADE)
+func (r *PostgresRepository) DeleteOrder(ctx context.Context, orderUID string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Write)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return checkTimeout(ctx, "delete order", fmt.Errorf("failed to begin transaction: %v", err))
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM orders WHERE order_uid = $1`, orderUID)
+	if err != nil {
+		return checkTimeout(ctx, "delete order", fmt.Errorf("failed to delete order: %v", err))
+	}
+	if err := rowsFound(res, orderUID); err != nil {
+		return err
+	}
+
+	// Журнал удалений для DeletedOrderUIDs, старые записи удаляются здесь же
+	if _, err := tx.ExecContext(ctx, `INSERT INTO order_deletions (order_uid) VALUES ($1)`, orderUID); err != nil {
+		return checkTimeout(ctx, "delete order", fmt.Errorf("failed to log order deletion: %v", err))
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM order_deletions WHERE deleted_at < now() - $1 * interval '1 second'`,
+		int64(DeletionRetention/time.Second)); err != nil {
+		return checkTimeout(ctx, "delete order", fmt.Errorf("failed to prune order deletions: %v", err))
+	}
+
+	if err = tx.Commit(); err != nil {
+		return checkTimeout(ctx, "delete order", fmt.Errorf("failed to commit transaction: %v", err))
+	}
+	return nil
+}
+
+// DeletedOrderUIDs возвращает order_uid архивированных заказов и заказов из
+// журнала удалений order_deletions, удаленных не раньше since
+func (r *PostgresRepository) DeletedOrderUIDs(ctx context.Context, since time.Time) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Read)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT order_uid FROM orders WHERE deleted_at >= $1
+		UNION SELECT order_uid FROM order_deletions WHERE deleted_at >= $1`, since)
+	if err != nil {
+		return nil, checkTimeout(ctx, "deleted orders", fmt.Errorf("failed to query deleted orders: %v", err))
+	}
+	defer rows.Close()
+
+	var orderUIDs []string
+	for rows.Next() {
+		var orderUID string
+		if err := rows.Scan(&orderUID); err != nil {
+			return nil, checkTimeout(ctx, "deleted orders", fmt.Errorf("failed to scan order UID: %v", err))
+		}
+		orderUIDs = append(orderUIDs, orderUID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, checkTimeout(ctx, "deleted orders", fmt.Errorf("error iterating order UIDs: %v", err))
+	}
+	return orderUIDs, nil
+}
+
+// ArchiveOrder помечает заказ удаленным (deleted_at = now()), повторная архивация
+// сохраняет исходное время
+func (r *PostgresRepository) ArchiveOrder(ctx context.Context, orderUID string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Write)
+	defer cancel()
+
+	res, err := r.db.ExecContext(ctx, `UPDATE orders SET deleted_at = coalesce(deleted_at, now())
+		WHERE order_uid = $1`, orderUID)
+	if err != nil {
+		return checkTimeout(ctx, "archive order", fmt.Errorf("failed to archive order: %v", err))
+	}
+	return rowsFound(res, orderUID)
+}
+
+// rowsFound возвращает ErrNotFound, если запрос не затронул ни одной строки
+func rowsFound(res sql.Result, orderUID string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, orderUID)
+	}
+	return nil
+}
+
+// UpdateOrder заменяет заказ и добавляет версию в одной транзакции. Строка
+// заказа блокируется, поэтому версии одного заказа идут подряд без пропусков.
+func (r *PostgresRepository) UpdateOrder(ctx context.Context, order *models.Order, opts SaveOptions) (UpdateResult, error) {
+	source, err := newRevisionSource(opts)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Write)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return UpdateResult{}, checkTimeout(ctx, "update order", fmt.Errorf("failed to begin transaction: %v", err))
+	}
+	defer tx.Rollback()
+
+	result, err := updateOrderTx(ctx, tx, order, source)
+	if err != nil {
+		return UpdateResult{}, checkTimeout(ctx, "update order", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return UpdateResult{}, checkTimeout(ctx, "update order", fmt.Errorf("failed to commit transaction: %v", err))
+	}
+
+	logging.Debugf("Order %s updated to version %d", order.OrderUID, result.Version)
+	return result, nil
+}
+
+func updateOrderTx(ctx context.Context, tx *sql.Tx, order *models.Order, source revisionSource) (UpdateResult, error) {
+	existing, err := getOrder(ctx, tx, order.OrderUID, true)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	if existing.DeletedAt != nil {
+		return UpdateResult{}, fmt.Errorf("%w: %s", ErrNotFound, order.OrderUID)
+	}
+
+	stored := order.Clone()
+	stored.DateCreated = stored.DateCreated.Round(time.Microsecond)
+	if existing.Equal(stored) {
+		version, err := lastVersion(ctx, tx, order.OrderUID)
+		if err != nil {
+			return UpdateResult{}, err
+		}
+		return UpdateResult{Version: version}, saveRaw(ctx, tx, order.OrderUID, source, false)
+	}
+
+	if err := replaceOrderTx(ctx, tx, order); err != nil {
+		return UpdateResult{}, err
+	}
+	version, err := recordWrite(ctx, tx, stored, source, EventOrderUpdated)
+	return UpdateResult{Version: version, Changed: true}, err
+}
+
+// recordWrite сопровождает запись заказа в той же транзакции: добавляет версию
+// в историю, обновляет raw_orders и пишет событие eventType в outbox
+func recordWrite(ctx context.Context, tx *sql.Tx, order *models.Order, source revisionSource, eventType string) (int, error) {
+	version, err := appendRevision(ctx, tx, order, source)
+	if err != nil {
+		return 0, err
+	}
+	if err := saveRaw(ctx, tx, order.OrderUID, source, true); err != nil {
+		return 0, err
+	}
+
+	payload, err := orderEventPayload(eventType, order, version)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO order_outbox (event_type, order_uid, version, payload)
+		VALUES ($1, $2, $3, $4)`, eventType, order.OrderUID, version, payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert outbox event: %v", err)
+	}
+	return version, nil
+}
+
+// saveRaw записывает исходное сообщение заказа из source. overwrite = true -
+// заказ записан: сообщение заменяется, а без сообщения удаляется (см. SaveOptions).
+// overwrite = false - заказ не менялся, сообщение пишется, только если его еще нет.
+func saveRaw(ctx context.Context, tx *sql.Tx, orderUID string, source revisionSource, overwrite bool) error {
+	raw := source.raw(orderUID)
+	if raw == nil {
+		if !overwrite || source.keepsRaw() {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM raw_orders WHERE order_uid = $1`, orderUID); err != nil {
+			return fmt.Errorf("failed to delete raw order: %v", err)
+		}
+		return nil
+	}
+
+	query := `INSERT INTO raw_orders (order_uid, payload, nats_sequence, nats_timestamp)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (order_uid) DO `
+	if overwrite {
+		query += `UPDATE SET payload = EXCLUDED.payload, nats_sequence = EXCLUDED.nats_sequence,
+			nats_timestamp = EXCLUDED.nats_timestamp, received_at = now()`
+	} else {
+		query += `NOTHING`
+	}
+
+	var sequence, timestamp any
+	if raw.Sequence != 0 {
+		sequence = int64(raw.Sequence)
+	}
+	if !raw.Timestamp.IsZero() {
+		timestamp = raw.Timestamp
+	}
+	if _, err := tx.ExecContext(ctx, query, raw.OrderUID, []byte(raw.Payload), sequence, timestamp); err != nil {
+		return fmt.Errorf("failed to save raw order: %v", err)
+	}
+	return nil
+}
+
+// GetRawOrder возвращает исходное сообщение заказа
+func (r *PostgresRepository) GetRawOrder(ctx context.Context, orderUID string) (*RawOrder, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Read)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, rawOrdersQuery+`WHERE order_uid = $1`, orderUID)
+	if err != nil {
+		return nil, checkTimeout(ctx, "get raw order", fmt.Errorf("failed to get raw order: %v", err))
+	}
+	raws, err := scanRawOrders(rows)
+	if err != nil {
+		return nil, checkTimeout(ctx, "get raw order", err)
+	}
+	if len(raws) == 0 {
+		return nil, fmt.Errorf("%w: raw order %s", ErrNotFound, orderUID)
+	}
+	return raws[0], nil
+}
+
+const rawOrdersQuery = `SELECT order_uid, payload, nats_sequence, nats_timestamp, received_at
+	FROM raw_orders `
+
+// StreamRawOrders читает исходные сообщения пачками по order_uid; каждая
+// пачка - отдельный запрос со своим дедлайном Stream, fn вызывается вне запроса
+func (r *PostgresRepository) StreamRawOrders(ctx context.Context, opts RawStreamOptions, fn func(*RawOrder) error) error {
+	batchSize := opts.batchSize()
+	last := ""
+	for {
+		batch, err := r.loadRawBatch(ctx, opts.Prefix, last, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, raw := range batch {
+			if err := fn(raw); err != nil {
+				return err
+			}
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		last = batch[len(batch)-1].OrderUID
+	}
+}
+
+func (r *PostgresRepository) loadRawBatch(ctx context.Context, prefix, after string, limit int) ([]*RawOrder, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Stream)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, rawOrdersQuery+`WHERE order_uid > $1 AND starts_with(order_uid, $2)
+		ORDER BY order_uid LIMIT $3`, after, prefix, limit)
+	if err != nil {
+		return nil, checkTimeout(ctx, "stream raw orders", fmt.Errorf("failed to query raw orders: %v", err))
+	}
+	batch, err := scanRawOrders(rows)
+	if err != nil {
+		return nil, checkTimeout(ctx, "stream raw orders", err)
+	}
+	return batch, nil
+}
+
+// scanRawOrders читает и закрывает rows запроса rawOrdersQuery
+func scanRawOrders(rows *sql.Rows) ([]*RawOrder, error) {
+	defer rows.Close()
+
+	var raws []*RawOrder
+	for rows.Next() {
+		var (
+			raw       RawOrder
+			payload   []byte
+			sequence  sql.NullInt64
+			timestamp sql.NullTime
+		)
+		if err := rows.Scan(&raw.OrderUID, &payload, &sequence, &timestamp, &raw.ReceivedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan raw order: %v", err)
+		}
+		raw.Payload = payload
+		raw.Sequence = uint64(sequence.Int64)
+		raw.Timestamp = timestamp.Time
+		raws = append(raws, &raw)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read raw orders: %v", err)
+	}
+	return raws, nil
+}
+
+// lastVersion возвращает номер последней версии заказа, 0 - версий нет
+func lastVersion(ctx context.Context, q querier, orderUID string) (int, error) {
+	var version int
+	err := q.QueryRowContext(ctx, `SELECT coalesce(max(version), 0) FROM order_revisions
+		WHERE order_uid = $1`, orderUID).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get order version: %v", err)
+	}
+	return version, nil
+}
+
+// appendRevision добавляет следующую версию заказа. Вызывается под блокировкой
+// строки заказа (или сразу после ее вставки), поэтому номера не пересекаются.
+func appendRevision(ctx context.Context, tx *sql.Tx, order *models.Order, source revisionSource) (int, error) {
+	version, err := lastVersion(ctx, tx, order.OrderUID)
+	if err != nil {
+		return 0, err
+	}
+	version++
+
+	data, err := json.Marshal(revisionOrder(order))
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal order revision: %v", err)
+	}
+	// nil пишется как NULL, а не как пустая строка
+	var message any
+	if source.message != nil {
+		message = []byte(source.message)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO order_revisions (order_uid, version, source, data, message)
+		VALUES ($1, $2, $3, $4, $5)`, order.OrderUID, version, source.name, data, message)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert order revision: %v", err)
+	}
+	return version, nil
 }
 
-func (r *PostgresRepository) Close() {
-	r.db.Close()
+// GetOrderHistory возвращает версии заказа от первой к последней
+func (r *PostgresRepository) GetOrderHistory(ctx context.Context, orderUID string, opts ReadOptions) ([]Revision, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Read)
+	defer cancel()
+
+	revisions, err := r.loadRevisions(ctx, orderUID, 0, opts)
+	if err != nil {
+		return nil, checkTimeout(ctx, "get order history", err)
+	}
+	return revisions, nil
 }
 
-// SaveOrder сохраняет заказ в БД (транзакционно)
-func (r *PostgresRepository) SaveOrder(order *models.Order) error {
-	// Сначала проверяем, существует ли уже заказ с таким order_uid
-	exists, err := r.orderExists(order.OrderUID)
+// GetOrderRevision возвращает версию заказа
+func (r *PostgresRepository) GetOrderRevision(ctx context.Context, orderUID string, version int, opts ReadOptions) (*Revision, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Read)
+	defer cancel()
+
+	revisions, err := r.loadRevisions(ctx, orderUID, version, opts)
 	if err != nil {
-		return fmt.Errorf("failed to check order existence: %v", err)
+		return nil, checkTimeout(ctx, "get order revision", err)
 	}
-	if exists {
-		return fmt.Errorf("order with UID %s already exists", order.OrderUID)
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("%w: %s version %d", ErrNotFound, orderUID, version)
 	}
+	return &revisions[0], nil
+}
 
-	tx, err := r.db.Begin()
+// loadRevisions читает версии заказа, version > 0 - только одну.
+// Архивный заказ без opts.IncludeDeleted считается отсутствующим.
+func (r *PostgresRepository) loadRevisions(ctx context.Context, orderUID string, version int, opts ReadOptions) ([]Revision, error) {
+	var deletedAt *time.Time
+	err := r.db.QueryRowContext(ctx, `SELECT deleted_at FROM orders WHERE order_uid = $1`, orderUID).Scan(&deletedAt)
+	if err == sql.ErrNoRows || (err == nil && deletedAt != nil && !opts.IncludeDeleted) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, orderUID)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return nil, fmt.Errorf("failed to get order: %v", err)
 	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
 
-	// Вставляем в таблицу orders
-	orderQuery := `INSERT INTO orders (
-		order_uid, track_number, entry, locale, internal_signature, 
-		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
-
-	_, err = tx.Exec(orderQuery,
-		order.OrderUID,
-		order.TrackNumber,
-		order.Entry,
-		order.Locale,
-		order.InternalSignature,
-		order.CustomerID,
-		order.DeliveryService,
-		order.Shardkey,
-		order.SmID,
-		order.DateCreated,
-		order.OofShard,
-	)
+	rows, err := r.db.QueryContext(ctx, `SELECT version, created_at, source, data, message
+		FROM order_revisions
+		WHERE order_uid = $1 AND ($2 = 0 OR version = $2)
+		ORDER BY version`, orderUID, version)
 	if err != nil {
-		return fmt.Errorf("failed to insert order: %v", err)
+		return nil, fmt.Errorf("failed to get order revisions: %v", err)
 	}
+	defer rows.Close()
 
-	// Вставляем в таблицу deliveries
-	deliveryQuery := `INSERT INTO deliveries (
-		order_uid, name, phone, zip, city, address, region, email
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-
-	_, err = tx.Exec(deliveryQuery,
-		order.OrderUID,
-		order.Delivery.Name,
-		order.Delivery.Phone,
-		order.Delivery.Zip,
-		order.Delivery.City,
-		order.Delivery.Address,
-		order.Delivery.Region,
-		order.Delivery.Email,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to insert delivery: %v", err)
+	revisions := []Revision{}
+	for rows.Next() {
+		var (
+			revision Revision
+			data     []byte
+			message  []byte
+		)
+		if err := rows.Scan(&revision.Version, &revision.CreatedAt, &revision.Source, &data, &message); err != nil {
+			return nil, fmt.Errorf("failed to scan order revision: %v", err)
+		}
+		if err := json.Unmarshal(data, &revision.Order); err != nil {
+			return nil, fmt.Errorf("failed to decode order %s version %d: %v", orderUID, revision.Version, err)
+		}
+		if message != nil {
+			revision.Message = message
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read order revisions: %v", err)
 	}
+	return revisions, nil
+}
 
-	// Вставляем в таблицу payments
-	paymentQuery := `INSERT INTO payments (
-		transaction, request_id, currency, provider, amount, 
-		payment_dt, bank, delivery_cost, goods_total, custom_fee
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+// ClaimOutboxEvents резервирует события продлением next_attempt_at на lease.
+// FOR UPDATE SKIP LOCKED не дает двум экземплярам выбрать одни и те же события,
+// резерв держится без открытой транзакции на время публикации.
+func (r *PostgresRepository) ClaimOutboxEvents(ctx context.Context, opts ClaimOptions) ([]OutboxEvent, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Write)
+	defer cancel()
 
-	_, err = tx.Exec(paymentQuery,
-		order.Payment.Transaction,
-		order.Payment.RequestID,
-		order.Payment.Currency,
-		order.Payment.Provider,
-		order.Payment.Amount,
-		order.Payment.PaymentDt,
-		order.Payment.Bank,
-		order.Payment.DeliveryCost,
-		order.Payment.GoodsTotal,
-		order.Payment.CustomFee,
+	rows, err := r.db.QueryContext(ctx, `UPDATE order_outbox SET
+		attempts = attempts + 1,
+		next_attempt_at = now() + $2 * interval '1 millisecond'
+	WHERE id IN (
+		SELECT o.id FROM order_outbox o
+		WHERE o.sent_at IS NULL AND o.next_attempt_at <= now() AND starts_with(o.order_uid, $3)
+			AND NOT EXISTS (
+				SELECT 1 FROM order_outbox e
+				WHERE e.order_uid = o.order_uid AND e.sent_at IS NULL AND e.id < o.id
+			)
+		ORDER BY o.id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
 	)
+	RETURNING id, event_type, order_uid, version, payload, created_at, attempts`, opts.Limit, opts.Lease.Milliseconds(), opts.Prefix)
 	if err != nil {
-		return fmt.Errorf("failed to insert payment: %v", err)
+		return nil, checkTimeout(ctx, "claim outbox events", fmt.Errorf("failed to claim outbox events: %v", err))
 	}
+	defer rows.Close()
 
-	// Вставляем все items
-	itemQuery := `INSERT INTO items (
-		order_uid, chrt_id, track_number, price, rid, name, 
-		sale, size, total_price, nm_id, brand, status
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
-
-	for _, item := range order.Items {
-		_, err = tx.Exec(itemQuery,
-			order.OrderUID,
-			item.ChrtID,
-			item.TrackNumber,
-			item.Price,
-			item.Rid,
-			item.Name,
-			item.Sale,
-			item.Size,
-			item.TotalPrice,
-			item.NmID,
-			item.Brand,
-			item.Status,
+	var events []OutboxEvent
+	for rows.Next() {
+		var (
+			event   OutboxEvent
+			payload []byte
 		)
-		if err != nil {
-			return fmt.Errorf("failed to insert item: %v", err)
+		if err := rows.Scan(&event.ID, &event.Type, &event.OrderUID, &event.Version, &payload, &event.CreatedAt, &event.Attempts); err != nil {
+			return nil, checkTimeout(ctx, "claim outbox events", fmt.Errorf("failed to scan outbox event: %v", err))
 		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, checkTimeout(ctx, "claim outbox events", fmt.Errorf("failed to read outbox events: %v", err))
 	}
 
-	// Коммитим транзакцию
-	if err = tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+	// RETURNING не сохраняет порядок подзапроса
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+// MarkOutboxSent отмечает события отправленными
+func (r *PostgresRepository) MarkOutboxSent(ctx context.Context, ids []int64) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Write)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `UPDATE order_outbox SET sent_at = now(), last_error = NULL
+		WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return checkTimeout(ctx, "mark outbox sent", fmt.Errorf("failed to mark outbox events sent: %v", err))
 	}
+	return nil
+}
+
+// MarkOutboxFailed откладывает следующую попытку публикации события
+func (r *PostgresRepository) MarkOutboxFailed(ctx context.Context, id int64, retryAt time.Time, reason string) error {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Write)
+	defer cancel()
 
-	log.Printf("Order %s saved successfully", order.OrderUID)
+	_, err := r.db.ExecContext(ctx, `UPDATE order_outbox SET next_attempt_at = $2, last_error = $3
+		WHERE id = $1 AND sent_at IS NULL`, id, retryAt, reason)
+	if err != nil {
+		return checkTimeout(ctx, "mark outbox failed", fmt.Errorf("failed to mark outbox event failed: %v", err))
+	}
 	return nil
 }
 
-// orderExists проверяет существует ли заказ с указанным order_uid
-func (r *PostgresRepository) orderExists(orderUID string) (bool, error) {
-	var exists bool
-	query := "SELECT EXISTS(SELECT 1 FROM orders WHERE order_uid = $1)"
-	err := r.db.QueryRow(query, orderUID).Scan(&exists)
+// DeleteSentOutboxEvents удаляет старые отправленные события
+func (r *PostgresRepository) DeleteSentOutboxEvents(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Write)
+	defer cancel()
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM order_outbox WHERE sent_at < $1`, before)
+	if err != nil {
+		return 0, checkTimeout(ctx, "delete sent outbox events", fmt.Errorf("failed to delete sent outbox events: %v", err))
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
-		return false, err
+		return 0, fmt.Errorf("failed to get affected rows: %v", err)
 	}
-	return exists, nil
+	return int(n), nil
 }
 
-// GetOrderByUID возвращает заказ по его UID
-func (r *PostgresRepository) GetOrderByUID(orderUID string) (*models.Order, error) {
+// getOrder читает заказ через q; lock блокирует строку заказа до конца транзакции
+func getOrder(ctx context.Context, q querier, orderUID string, lock bool) (*models.Order, error) {
 	// Получаем основные данные заказа
 	orderQuery := `SELECT
 		order_uid, track_number, entry, locale, internal_signature,
-		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+		customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, deleted_at
 	FROM orders WHERE order_uid = $1`
+	if lock {
+		orderQuery += ` FOR UPDATE`
+	}
 
 	order := &models.Order{}
-	err := r.db.QueryRow(orderQuery, orderUID).Scan(
+	err := q.QueryRowContext(ctx, orderQuery, orderUID).Scan(
 		&order.OrderUID,
 		&order.TrackNumber,
 		&order.Entry,
@@ -182,10 +1074,11 @@ func (r *PostgresRepository) GetOrderByUID(orderUID string) (*models.Order, erro
 		&order.SmID,
 		&order.DateCreated,
 		&order.OofShard,
+		&order.DeletedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("order not found: %s", orderUID)
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, orderUID)
 		}
 		return nil, fmt.Errorf("failed to get order: %v", err)
 	}
@@ -196,7 +1089,7 @@ func (r *PostgresRepository) GetOrderByUID(orderUID string) (*models.Order, erro
 	FROM deliveries WHERE order_uid = $1`
 
 	delivery := &models.Delivery{}
-	err = r.db.QueryRow(deliveryQuery, orderUID).Scan(
+	err = q.QueryRowContext(ctx, deliveryQuery, orderUID).Scan(
 		&delivery.Name,
 		&delivery.Phone,
 		&delivery.Zip,
@@ -217,7 +1110,7 @@ func (r *PostgresRepository) GetOrderByUID(orderUID string) (*models.Order, erro
 	FROM payments WHERE transaction = $1`
 
 	payment := &models.Payment{}
-	err = r.db.QueryRow(paymentQuery, orderUID).Scan(
+	err = q.QueryRowContext(ctx, paymentQuery, orderUID).Scan(
 		&payment.Transaction,
 		&payment.RequestID,
 		&payment.Currency,
@@ -238,9 +1131,9 @@ func (r *PostgresRepository) GetOrderByUID(orderUID string) (*models.Order, erro
 	itemsQuery := `SELECT
 		chrt_id, track_number, price, rid, name, sale, size,
 		total_price, nm_id, brand, status
-	FROM items WHERE order_uid = $1`
+	FROM items WHERE order_uid = $1 ORDER BY id`
 
-	rows, err := r.db.Query(itemsQuery, orderUID)
+	rows, err := q.QueryContext(ctx, itemsQuery, orderUID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get items: %v", err)
 	}
@@ -276,109 +1169,403 @@ func (r *PostgresRepository) GetOrderByUID(orderUID string) (*models.Order, erro
 	return order, nil
 }
 
-// GetAllOrders возвращает все заказы (для восстановления кэша)
-func (r *PostgresRepository) GetAllOrders() ([]models.Order, error) {
-	// Получаем все order_uid
-	orderUIDsQuery := `SELECT order_uid FROM orders`
-	rows, err := r.db.Query(orderUIDsQuery)
+// GetAllOrders возвращает все заказы от старых к новым. Держит в памяти
+// все заказы сразу, для больших объемов нужен StreamOrders.
+func (r *PostgresRepository) GetAllOrders(ctx context.Context) ([]models.Order, error) {
+	var orders []models.Order
+	err := r.StreamOrders(ctx, StreamOptions{}, func(order *models.Order) error {
+		orders = append(orders, *order)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Infof("Loaded %d orders from database", len(orders))
+	return orders, nil
+}
+
+// CountOrders возвращает число заказов
+func (r *PostgresRepository) CountOrders(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Read)
+	defer cancel()
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM orders WHERE deleted_at IS NULL`).Scan(&count); err != nil {
+		return 0, checkTimeout(ctx, "count orders", fmt.Errorf("failed to count orders: %v", err))
+	}
+	return count, nil
+}
+
+// selectOrdersQuery выбирает заказы с доставкой и платежом в порядке полей loadOrderBatch
+const selectOrdersQuery = `SELECT
+		o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+		o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.deleted_at,
+		d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+		p.transaction, p.request_id, p.currency, p.provider, p.amount,
+		p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+	FROM orders o
+	JOIN deliveries d ON d.order_uid = o.order_uid
+	JOIN payments p ON p.transaction = o.order_uid`
+
+// streamOrdersQuery выбирает пачку заказов после курсора (date_created, order_uid).
+// %[1]s - условие курсора, %[2]s - направление сортировки.
+const streamOrdersQuery = selectOrdersQuery + `
+	WHERE o.created_at >= $1 AND o.deleted_at IS NULL AND %[1]s
+	ORDER BY o.date_created %[2]s, o.order_uid %[2]s
+	LIMIT $2`
+
+// StreamOrders передает fn все заказы по порядку date_created, загружая их
+// пачками по opts.BatchSize: одна выборка заказов с доставкой и платежом и одна
+// выборка товаров на пачку. В памяти одновременно не больше одной пачки.
+// Таймаут Timeouts.Stream действует на загрузку каждой пачки, а не на все чтение.
+// Ошибка fn прерывает чтение и возвращается как есть.
+func (r *PostgresRepository) StreamOrders(ctx context.Context, opts StreamOptions, fn func(*models.Order) error) error {
+	batchSize := opts.batchSize()
+	direction, cursorCond := "ASC", "(o.date_created, o.order_uid) > ($3, $4)"
+	if opts.NewestFirst {
+		direction, cursorCond = "DESC", "(o.date_created, o.order_uid) < ($3, $4)"
+	}
+	firstQuery := fmt.Sprintf(streamOrdersQuery, "TRUE", direction)
+	nextQuery := fmt.Sprintf(streamOrdersQuery, cursorCond, direction)
+
+	var last *models.Order
+	for {
+		batch, err := r.loadBatch(ctx, firstQuery, nextQuery, opts.CreatedSince, batchSize, last)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for _, order := range batch {
+			if err := fn(order); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < batchSize {
+			return nil
+		}
+		last = batch[len(batch)-1]
+	}
+}
+
+// loadBatch загружает пачку заказов с товарами после заказа last (nil - первую пачку)
+func (r *PostgresRepository) loadBatch(ctx context.Context, firstQuery, nextQuery string, since time.Time, limit int, last *models.Order) ([]*models.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Stream)
+	defer cancel()
+
+	var (
+		batch []*models.Order
+		err   error
+	)
+	if last == nil {
+		batch, err = loadOrderBatch(ctx, r.db, firstQuery, since, limit)
+	} else {
+		batch, err = loadOrderBatch(ctx, r.db, nextQuery, since, limit, last.DateCreated, last.OrderUID)
+	}
+	if err == nil && len(batch) > 0 {
+		err = loadBatchItems(ctx, r.db, batch)
+	}
+	if err != nil {
+		return nil, checkTimeout(ctx, "stream orders", err)
+	}
+	return batch, nil
+}
+
+// loadOrderBatch выбирает пачку заказов без товаров запросом на основе selectOrdersQuery
+func loadOrderBatch(ctx context.Context, q querier, query string, args ...any) ([]*models.Order, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order UIDs: %v", err)
+		return nil, fmt.Errorf("failed to get orders: %v", err)
 	}
 	defer rows.Close()
 
-	var orders []models.Order
-	var orderUIDs []string
+	var batch []*models.Order
+	for rows.Next() {
+		order := &models.Order{}
+		err := rows.Scan(
+			&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
+			&order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.DeletedAt,
+			&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip, &order.Delivery.City,
+			&order.Delivery.Address, &order.Delivery.Region, &order.Delivery.Email,
+			&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency, &order.Payment.Provider,
+			&order.Payment.Amount, &order.Payment.PaymentDt, &order.Payment.Bank, &order.Payment.DeliveryCost,
+			&order.Payment.GoodsTotal, &order.Payment.CustomFee,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %v", err)
+		}
+		batch = append(batch, order)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating orders: %v", err)
+	}
+
+	return batch, nil
+}
+
+// loadBatchItems загружает товары всех заказов пачки одним запросом
+func loadBatchItems(ctx context.Context, q querier, batch []*models.Order) error {
+	byUID := make(map[string]*models.Order, len(batch))
+	orderUIDs := make([]string, len(batch))
+	for i, order := range batch {
+		byUID[order.OrderUID] = order
+		orderUIDs[i] = order.OrderUID
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT
+		order_uid, chrt_id, track_number, price, rid, name, sale, size,
+		total_price, nm_id, brand, status
+	FROM items WHERE order_uid = ANY($1) ORDER BY order_uid, id`, pq.Array(orderUIDs))
+	if err != nil {
+		return fmt.Errorf("failed to get items: %v", err)
+	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var orderUID string
-		if err := rows.Scan(&orderUID); err != nil {
-			return nil, fmt.Errorf("failed to scan order UID: %v", err)
+		item := models.Item{}
+		err := rows.Scan(
+			&orderUID,
+			&item.ChrtID,
+			&item.TrackNumber,
+			&item.Price,
+			&item.Rid,
+			&item.Name,
+			&item.Sale,
+			&item.Size,
+			&item.TotalPrice,
+			&item.NmID,
+			&item.Brand,
+			&item.Status,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan item: %v", err)
+		}
+		order := byUID[orderUID]
+		order.Items = append(order.Items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating items: %v", err)
+	}
+
+	return nil
+}
+
+// ListOrders выбирает страницу заказов одним запросом заказов и одним запросом
+// товаров. Фильтры складываются в WHERE, страница продолжается по курсору
+// (date_created, order_uid) в порядке индексов из миграции 0004.
+func (r *PostgresRepository) ListOrders(ctx context.Context, filter OrderFilter, cursor string, limit int) (OrderPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return OrderPage{}, err
+	}
+	limit = listLimit(limit)
+
+	var (
+		conds []string
+		args  []any
+	)
+	cond := func(format string, values ...any) {
+		placeholders := make([]any, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conds = append(conds, fmt.Sprintf(format, placeholders...))
+	}
+
+	if !filter.IncludeDeleted {
+		cond("o.deleted_at IS NULL")
+	}
+	if !filter.CreatedFrom.IsZero() {
+		cond("o.date_created >= %s", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		cond("o.date_created < %s", filter.CreatedTo)
+	}
+	equal := []struct{ column, value string }{
+		{"o.customer_id", filter.CustomerID},
+		{"o.delivery_service", filter.DeliveryService},
+		{"o.locale", filter.Locale},
+		{"o.entry", filter.Entry},
+		{"p.provider", filter.Provider},
+		{"p.bank", filter.Bank},
+		{"p.currency", filter.Currency},
+	}
+	for _, e := range equal {
+		if e.value != "" {
+			cond(e.column+" = %s", e.value)
+		}
+	}
+	if filter.AmountMin != nil {
+		cond("p.amount >= %s", *filter.AmountMin)
+	}
+	if filter.AmountMax != nil {
+		cond("p.amount <= %s", *filter.AmountMax)
+	}
+	if filter.Brand != "" {
+		cond("EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.brand = %s)", filter.Brand)
+	}
+	if after != nil {
+		cond("(o.date_created, o.order_uid) < (%s, %s)", after.DateCreated, after.OrderUID)
+	}
+
+	query := selectOrdersQuery
+	if len(conds) > 0 {
+		query += "\n\tWHERE " + strings.Join(conds, " AND ")
+	}
+	// Лишний заказ показывает, есть ли следующая страница
+	args = append(args, limit+1)
+	query += fmt.Sprintf("\n\tORDER BY o.date_created DESC, o.order_uid DESC\n\tLIMIT $%d", len(args))
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Read)
+	defer cancel()
+
+	orders, err := loadOrderBatch(ctx, r.db, query, args...)
+	if err == nil && len(orders) > 0 {
+		err = loadBatchItems(ctx, r.db, orders)
+	}
+	if err != nil {
+		return OrderPage{}, checkTimeout(ctx, "list orders", err)
+	}
+
+	page := OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		page.NextCursor = encodeCursor(orders[limit-1])
+	}
+	if page.Orders == nil {
+		page.Orders = []*models.Order{}
+	}
+	return page, nil
+}
+
+// SearchOrders ищет по GIN-индексу order_search: сначала страница order_uid
+// по ts_rank, затем сами заказы теми же запросами, что и StreamOrders
+func (r *PostgresRepository) SearchOrders(ctx context.Context, query string, page SearchPage) (SearchResults, error) {
+	terms, err := searchTerms(query)
+	if err != nil {
+		return SearchResults{}, err
+	}
+	limit := page.limit()
+	offset := max(page.Offset, 0)
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Read)
+	defer cancel()
+
+	// Лишний результат показывает, есть ли следующая страница
+	rows, err := r.db.QueryContext(ctx, `SELECT s.order_uid, ts_rank(s.document, q) AS rank
+		FROM order_search s
+		JOIN orders o ON o.order_uid = s.order_uid, to_tsquery('simple', $1) q
+		WHERE s.document @@ q AND o.deleted_at IS NULL
+		ORDER BY rank DESC, s.order_uid
+		LIMIT $2 OFFSET $3`, tsQuery(terms), limit+1, offset)
+	if err != nil {
+		return SearchResults{}, checkTimeout(ctx, "search orders", fmt.Errorf("failed to search orders: %v", err))
+	}
+	defer rows.Close()
+
+	var (
+		orderUIDs []string
+		ranks     []float64
+	)
+	for rows.Next() {
+		var orderUID string
+		var rank float64
+		if err := rows.Scan(&orderUID, &rank); err != nil {
+			return SearchResults{}, checkTimeout(ctx, "search orders", fmt.Errorf("failed to scan search result: %v", err))
 		}
 		orderUIDs = append(orderUIDs, orderUID)
+		ranks = append(ranks, rank)
 	}
+	if err := rows.Err(); err != nil {
+		return SearchResults{}, checkTimeout(ctx, "search orders", fmt.Errorf("error iterating search results: %v", err))
+	}
+	rows.Close()
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating order UIDs: %v", err)
+	results := SearchResults{Results: []SearchResult{}}
+	if len(orderUIDs) > limit {
+		orderUIDs, ranks = orderUIDs[:limit], ranks[:limit]
+		results.NextOffset = offset + limit
+	}
+	if len(orderUIDs) == 0 {
+		return results, nil
 	}
 
-	// Для каждого order_uid получаем полный заказ
-	for _, orderUID := range orderUIDs {
-		order, err := r.GetOrderByUID(orderUID)
-		if err != nil {
-			log.Printf("Warning: failed to get order %s: %v", orderUID, err)
+	orders, err := loadOrderBatch(ctx, r.db, selectOrdersQuery+"\n\tWHERE o.order_uid = ANY($1)", pq.Array(orderUIDs))
+	if err == nil && len(orders) > 0 {
+		err = loadBatchItems(ctx, r.db, orders)
+	}
+	if err != nil {
+		return SearchResults{}, checkTimeout(ctx, "search orders", err)
+	}
+
+	byUID := make(map[string]*models.Order, len(orders))
+	for _, order := range orders {
+		byUID[order.OrderUID] = order
+	}
+	for i, orderUID := range orderUIDs {
+		order, ok := byUID[orderUID]
+		if !ok {
+			// Заказ удалили между запросами
 			continue
 		}
-		orders = append(orders, *order)
+		results.Results = append(results.Results, SearchResult{
+			Order:      order,
+			Rank:       ranks[i],
+			Highlights: highlight(order, terms),
+		})
 	}
+	return results, nil
+}
 
-	log.Printf("Loaded %d orders from database", len(orders))
-	return orders, nil
+// lookupQueries - запросы поиска order_uid по вторичным полям, новые заказы первыми
+var lookupQueries = map[models.LookupField]string{
+	models.ByTrackNumber: `SELECT order_uid FROM orders WHERE order_uid IN (
+		SELECT order_uid FROM orders WHERE track_number = $1
+		UNION SELECT order_uid FROM items WHERE track_number = $1
+	) AND deleted_at IS NULL ORDER BY date_created DESC, order_uid LIMIT $2`,
+	models.ByCustomerID: `SELECT order_uid FROM orders WHERE customer_id = $1 AND deleted_at IS NULL
+		ORDER BY date_created DESC, order_uid LIMIT $2`,
+	models.ByRid: `SELECT order_uid FROM orders WHERE order_uid IN (
+		SELECT order_uid FROM items WHERE rid = $1
+	) AND deleted_at IS NULL ORDER BY date_created DESC, order_uid LIMIT $2`,
+	models.ByChrtID: `SELECT order_uid FROM orders WHERE order_uid IN (
+		SELECT order_uid FROM items WHERE chrt_id = $1
+	) AND deleted_at IS NULL ORDER BY date_created DESC, order_uid LIMIT $2`,
 }
 
-// InitDB создает таблицы если они не существуют
-func (r *PostgresRepository) InitDB() error {
-    createTablesSQL := `
-    CREATE TABLE IF NOT EXISTS orders (
-        order_uid VARCHAR(255) PRIMARY KEY,
-        track_number VARCHAR(255),
-        entry VARCHAR(50),
-        locale VARCHAR(10),
-        internal_signature VARCHAR(255),
-        customer_id VARCHAR(255),
-        delivery_service VARCHAR(100),
-        shardkey VARCHAR(50),
-        sm_id INTEGER,
-        date_created TIMESTAMP WITH TIME ZONE,
-        oof_shard VARCHAR(50)
-    );
-
-    CREATE TABLE IF NOT EXISTS deliveries (
-        id SERIAL PRIMARY KEY,
-        order_uid VARCHAR(255) REFERENCES orders(order_uid) ON DELETE CASCADE,
-        name VARCHAR(255) NOT NULL,
-        phone VARCHAR(50),
-        zip VARCHAR(50),
-        city VARCHAR(100),
-        address TEXT,
-        region VARCHAR(100),
-        email VARCHAR(255)
-    );
-
-    CREATE TABLE IF NOT EXISTS payments (
-        transaction VARCHAR(255) PRIMARY KEY REFERENCES orders(order_uid) ON DELETE CASCADE,
-        request_id VARCHAR(255),
-        currency VARCHAR(10),
-        provider VARCHAR(100),
-        amount INTEGER,
-        payment_dt BIGINT,
-        bank VARCHAR(100),
-        delivery_cost INTEGER,
-        goods_total INTEGER,
-        custom_fee INTEGER
-    );
-
-    CREATE TABLE IF NOT EXISTS items (
-        id SERIAL PRIMARY KEY,
-        order_uid VARCHAR(255) REFERENCES orders(order_uid) ON DELETE CASCADE,
-        chrt_id BIGINT,
-        track_number VARCHAR(255),
-        price INTEGER,
-        rid VARCHAR(255),
-        name VARCHAR(255),
-        sale INTEGER,
-        size VARCHAR(50),
-        total_price INTEGER,
-        nm_id BIGINT,
-        brand VARCHAR(255),
-        status INTEGER
-    );
-    `
-
-    _, err := r.db.Exec(createTablesSQL)
-    if err != nil {
-        return fmt.Errorf("failed to create tables: %v", err)
-    }
-
-    log.Println("Database tables initialized successfully")
-    return nil
+// FindOrderUIDs возвращает order_uid заказов, у которых поле field равно value
+func (r *PostgresRepository) FindOrderUIDs(ctx context.Context, field models.LookupField, value string) ([]string, error) {
+	query, ok := lookupQueries[field]
+	if !ok {
+		return nil, fmt.Errorf("unsupported lookup field: %s", field)
+	}
+
+	ctx, cancel := withTimeout(ctx, r.timeouts.Load().Read)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, value, maxLookupResults)
+	if err != nil {
+		return nil, checkTimeout(ctx, "find orders", fmt.Errorf("failed to find orders by %s: %v", field, err))
+	}
+	defer rows.Close()
+
+	var orderUIDs []string
+	for rows.Next() {
+		var orderUID string
+		if err := rows.Scan(&orderUID); err != nil {
+			return nil, checkTimeout(ctx, "find orders", fmt.Errorf("failed to scan order UID: %v", err))
+		}
+		orderUIDs = append(orderUIDs, orderUID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, checkTimeout(ctx, "find orders", fmt.Errorf("error iterating order UIDs: %v", err))
+	}
+
+	return orderUIDs, nil
 }
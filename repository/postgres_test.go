@@ -0,0 +1,27 @@
+package repository_test
+
+import (
+	"os"
+	"testing"
+	"wb-orders-service/repository"
+	"wb-orders-service/repository/repotest"
+)
+
+// Проверки на PostgreSQL идут, только если задана строка подключения к БД,
+// которую можно изменять:
+//
+//	REPOTEST_POSTGRES_DSN="host=localhost user=postgres password=postgres dbname=orders sslmode=disable" go test ./repository
+func TestPostgresRepository(t *testing.T) {
+	dsn := os.Getenv("REPOTEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("REPOTEST_POSTGRES_DSN is not set")
+	}
+
+	repotest.Run(t, func() repository.OrderRepository {
+		repo, err := repository.NewPostgresRepository(t.Context(), dsn, repository.ConnectOptions{})
+		if err != nil {
+			t.Fatalf("failed to connect to database: %v", err)
+		}
+		return repo
+	})
+}
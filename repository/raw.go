@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"wb-orders-service/logging"
+	"wb-orders-service/models"
+)
+
+// RawOrder - исходное сообщение, из которого записан заказ. Хранится целиком,
+// вместе с полями, которых нет в models.Order.
+type RawOrder struct {
+	OrderUID   string          `json:"order_uid"`
+	Payload    json.RawMessage `json:"payload"`
+	Sequence   uint64          `json:"sequence,omitempty"` // номер сообщения в NATS Streaming
+	Timestamp  time.Time       `json:"timestamp,omitzero"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+func (r *RawOrder) clone() *RawOrder {
+	c := *r
+	c.Payload = bytes.Clone(r.Payload)
+	return &c
+}
+
+// RawStreamOptions - параметры StreamRawOrders
+type RawStreamOptions struct {
+	Prefix    string // только order_uid с этим префиксом, пусто - все
+	BatchSize int    // сообщений в пачке, 0 - defaultBatchSize
+}
+
+func (o RawStreamOptions) batchSize() int {
+	if o.BatchSize <= 0 {
+		return defaultBatchSize
+	}
+	return o.BatchSize
+}
+
+// RederiveSource - источник версий, записанных Rederive
+const RederiveSource = "rederive"
+
+// RederiveOptions - параметры Rederive
+type RederiveOptions struct {
+	Prefix   string                    // только order_uid с этим префиксом, пусто - все
+	DryRun   bool                      // только посчитать изменения, ничего не записывать
+	Validate func(*models.Order) error // проверка заказа из сообщения, nil - без проверки
+}
+
+// RederiveStats - итог Rederive
+type RederiveStats struct {
+	Total     int `json:"total"`     // сообщений прочитано
+	Changed   int `json:"changed"`   // заказов изменилось (при DryRun - изменилось бы)
+	Unchanged int `json:"unchanged"` // заказ совпал с сообщением
+	Archived  int `json:"archived"`  // архивные и удаленные во время пересборки заказы пропущены
+	Invalid   int `json:"invalid"`   // сообщение не разбирается или не прошло проверку
+}
+
+// Rederive заново разбирает исходные сообщения заказов текущей моделью и
+// записывает заказы, которые разошлись с нормализованными таблицами, как новые
+// версии с источником RederiveSource. Нужен после изменения models.Order:
+// поля, которые раньше отбрасывались, берутся из сохраненных сообщений.
+// Ошибки хранилища прерывают пересборку, уже записанные заказы остаются.
+func Rederive(ctx context.Context, repo OrderRepository, opts RederiveOptions) (RederiveStats, error) {
+	var stats RederiveStats
+	err := repo.StreamRawOrders(ctx, RawStreamOptions{Prefix: opts.Prefix}, func(raw *RawOrder) error {
+		stats.Total++
+
+		order, err := decodeRawOrder(raw)
+		if err == nil && opts.Validate != nil {
+			err = opts.Validate(order)
+		}
+		if err != nil {
+			logging.Warnf("Order %s: raw message skipped: %v", raw.OrderUID, err)
+			stats.Invalid++
+			return nil
+		}
+
+		current, err := repo.GetOrderByUID(ctx, raw.OrderUID, ReadOptions{IncludeDeleted: true})
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		switch {
+		case err != nil || current.DeletedAt != nil:
+			stats.Archived++
+			return nil
+		case current.Equal(order):
+			stats.Unchanged++
+			return nil
+		case opts.DryRun:
+			stats.Changed++
+			return nil
+		}
+
+		// Сообщение не передается: raw_orders остается как есть
+		result, err := repo.UpdateOrder(ctx, order, SaveOptions{Source: RederiveSource})
+		if errors.Is(err, ErrNotFound) {
+			// Заказ архивировали или удалили во время пересборки
+			stats.Archived++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if result.Changed {
+			stats.Changed++
+			logging.Infof("Order %s rederived as version %d", order.OrderUID, result.Version)
+		} else {
+			stats.Unchanged++
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// decodeRawOrder разбирает сообщение в заказ текущей модели
+func decodeRawOrder(raw *RawOrder) (*models.Order, error) {
+	var order models.Order
+	if err := json.Unmarshal(raw.Payload, &order); err != nil {
+		return nil, fmt.Errorf("failed to decode raw order: %v", err)
+	}
+	if order.OrderUID != raw.OrderUID {
+		return nil, fmt.Errorf("raw order has order_uid %q", order.OrderUID)
+	}
+	// Время архивации из сообщений не принимается
+	order.DeletedAt = nil
+	return &order, nil
+}
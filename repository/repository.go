@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"wb-orders-service/models"
+)
+
+var (
+	// ErrNotFound возвращается, если заказа с указанным order_uid нет в хранилище
+	ErrNotFound = errors.New("order not found")
+	// ErrConflict возвращается, если под тем же order_uid уже сохранен другой заказ
+	ErrConflict = errors.New("order conflicts with already saved order")
+	// ErrTimeout - операция не уложилась в дедлайн, errors.Is находит его в TimeoutError
+	ErrTimeout = errors.New("operation timed out")
+)
+
+// TimeoutError возвращается, если операция прервана дедлайном контекста
+type TimeoutError struct {
+	Op  string // операция: get order, save order, ...
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: %v: %v", e.Op, ErrTimeout, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// checkTimeout оборачивает err в TimeoutError, если истек дедлайн ctx.
+// Прочие ошибки, в том числе отмена контекста, возвращаются как есть.
+func checkTimeout(ctx context.Context, op string, err error) error {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return err
+	}
+	return &TimeoutError{Op: op, Err: err}
+}
+
+// Timeouts - дедлайны операций хранилища, 0 - без ограничения.
+// Дедлайн контекста вызывающего, если он раньше, действует как обычно.
+type Timeouts struct {
+	Read   time.Duration // чтение заказа, подсчет, поиск
+	Write  time.Duration // сохранение заказа целиком
+	Stream time.Duration // загрузка одной пачки StreamOrders
+}
+
+// withTimeout добавляет к ctx дедлайн d, если он задан
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// SavePolicy - что делать, если заказ с таким order_uid уже сохранен.
+// Совпадающий дубликат (повторная доставка сообщения) при любой политике
+// пропускается без ошибки с результатом SaveDuplicate.
+type SavePolicy int
+
+const (
+	SaveReject  SavePolicy = iota // отличающийся заказ - ErrConflict
+	SaveSkip                      // отличающийся заказ игнорируется, сохраненный остается
+	SaveReplace                   // заказ и все его дочерние записи заменяются атомарно
+	// SaveUpdate - отличающийся заказ записывается новой версией через UpdateOrder.
+	// Сам SaveOrder при этой политике возвращает ErrConflict, как при SaveReject.
+	SaveUpdate
+)
+
+var savePolicyNames = map[SavePolicy]string{
+	SaveReject:  "reject",
+	SaveSkip:    "skip",
+	SaveReplace: "replace",
+	SaveUpdate:  "update",
+}
+
+func (p SavePolicy) String() string {
+	if name, ok := savePolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("SavePolicy(%d)", int(p))
+}
+
+// ParseSavePolicy разбирает название политики: reject, skip, replace или update
+func ParseSavePolicy(name string) (SavePolicy, error) {
+	for policy, n := range savePolicyNames {
+		if n == name {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown save policy %q, want reject, skip, replace or update", name)
+}
+
+// SaveOptions - параметры SaveOrder и UpdateOrder
+type SaveOptions struct {
+	Policy SavePolicy // UpdateOrder не использует
+
+	// Источник и исходное сообщение (JSON) для истории версий заказа и
+	// raw_orders. Если заказ записан без сообщения, его запись в raw_orders
+	// удаляется: заказ больше не соответствует сообщению (кроме Rederive).
+	Source  string
+	Message []byte
+
+	// Номер и время сообщения в NATS Streaming, 0 - сообщение не из NATS
+	Sequence  uint64
+	Timestamp time.Time
+}
+
+// SaveResult - чем закончилось сохранение заказа
+type SaveResult int
+
+const (
+	SaveInserted  SaveResult = iota // новый заказ
+	SaveDuplicate                   // такой же заказ уже сохранен, ничего не изменено
+	SaveKept                        // SaveSkip: сохранен другой заказ, он оставлен как есть
+	SaveReplaced                    // SaveReplace: сохраненный заказ заменен
+)
+
+func (r SaveResult) String() string {
+	switch r {
+	case SaveInserted:
+		return "inserted"
+	case SaveDuplicate:
+		return "duplicate"
+	case SaveKept:
+		return "kept"
+	case SaveReplaced:
+		return "replaced"
+	}
+	return fmt.Sprintf("SaveResult(%d)", int(r))
+}
+
+// resolveExisting решает, что делать с заказом, если под его order_uid
+// уже сохранен existing. write = true - заказ нужно заменить.
+func resolveExisting(existing, order *models.Order, policy SavePolicy) (result SaveResult, write bool, err error) {
+	if existing.Equal(order) {
+		return SaveDuplicate, false, nil
+	}
+
+	switch policy {
+	case SaveSkip:
+		return SaveKept, false, nil
+	case SaveReplace:
+		return SaveReplaced, true, nil
+	default:
+		return 0, false, fmt.Errorf("%w: %s", ErrConflict, order.OrderUID)
+	}
+}
+
+// OrderRepository - хранилище заказов. Реализации: PostgresRepository и
+// MemoryRepository; обе обязаны проходить набор проверок repotest.
+// Возвращаемые заказы - копии, их изменение не влияет на хранилище.
+// Все операции прерываются отменой ctx; по истечении его дедлайна
+// возвращается ошибка, для которой errors.Is(err, ErrTimeout).
+type OrderRepository interface {
+	// SaveOrder сохраняет заказ. Проверка существующего заказа и запись
+	// выполняются атомарно; если order_uid занят, действует opts.Policy.
+	SaveOrder(ctx context.Context, order *models.Order, opts SaveOptions) (SaveResult, error)
+	// SaveOrdersBatch сохраняет пачку новых заказов в одной транзакции, каждый -
+	// как SaveOrder с SaveReject: версия 1 и событие order.created. Заказы, которые
+	// нельзя записать, не прерывают пачку и возвращаются в BatchResult.Rejected;
+	// при ошибке не записан ни один заказ пачки.
+	SaveOrdersBatch(ctx context.Context, batch []BatchOrder, opts BatchOptions) (BatchResult, error)
+	// GetOrderByUID возвращает заказ или ошибку, обернутую в ErrNotFound.
+	// Архивный заказ возвращается только с opts.IncludeDeleted.
+	GetOrderByUID(ctx context.Context, orderUID string, opts ReadOptions) (*models.Order, error)
+	// GetOrdersByUIDs возвращает заказы с указанными order_uid в том же порядке
+	// одним чтением. Отсутствующие и архивные заказы пропускаются.
+	GetOrdersByUIDs(ctx context.Context, orderUIDs []string) ([]*models.Order, error)
+	// DeleteOrder удаляет заказ со всеми дочерними записями
+	DeleteOrder(ctx context.Context, orderUID string) error
+	// ArchiveOrder помечает заказ удаленным: он пропадает из чтений, поиска,
+	// подсчета и прогрева кэша, но остается в хранилище. Сохранение заказа
+	// с тем же order_uid и политикой SaveReplace возвращает его из архива.
+	ArchiveOrder(ctx context.Context, orderUID string) error
+	// UpdateOrder записывает новую версию существующего заказа. Если заказа нет
+	// или он архивирован - ErrNotFound; заказ, совпадающий с текущей версией,
+	// не создает новую.
+	UpdateOrder(ctx context.Context, order *models.Order, opts SaveOptions) (UpdateResult, error)
+	// GetOrderHistory возвращает версии заказа от первой к последней.
+	// Каждое сохранение заказа (вставка, замена, UpdateOrder) добавляет версию.
+	GetOrderHistory(ctx context.Context, orderUID string, opts ReadOptions) ([]Revision, error)
+	// GetOrderRevision возвращает версию заказа, ErrNotFound - такой версии нет
+	GetOrderRevision(ctx context.Context, orderUID string, version int, opts ReadOptions) (*Revision, error)
+	// GetRawOrder возвращает исходное сообщение, из которого записан заказ,
+	// ErrNotFound - заказа или сообщения нет
+	GetRawOrder(ctx context.Context, orderUID string) (*RawOrder, error)
+	// StreamRawOrders передает fn исходные сообщения заказов (и архивных) по
+	// порядку order_uid. Ошибка fn прерывает чтение и возвращается как есть.
+	StreamRawOrders(ctx context.Context, opts RawStreamOptions, fn func(*RawOrder) error) error
+	// GetAllOrders возвращает все заказы от старых к новым по date_created.
+	// Для больших объемов нужен StreamOrders.
+	GetAllOrders(ctx context.Context) ([]models.Order, error)
+	// StreamOrders передает fn заказы по порядку date_created, order_uid, не держа
+	// в памяти больше пачки. Ошибка fn прерывает чтение и возвращается как есть.
+	StreamOrders(ctx context.Context, opts StreamOptions, fn func(*models.Order) error) error
+	// CountOrders возвращает число заказов
+	CountOrders(ctx context.Context) (int, error)
+	// ListOrders возвращает страницу заказов, подходящих под filter, от новых к старым.
+	// cursor - NextCursor предыдущей страницы, пустой - первая страница;
+	// limit приводится к 1..MaxListLimit, 0 - DefaultListLimit.
+	ListOrders(ctx context.Context, filter OrderFilter, cursor string, limit int) (OrderPage, error)
+	// SearchOrders ищет заказы по словам из названий и брендов товаров и из
+	// имени, города и адреса доставки; результаты - по убыванию релевантности
+	SearchOrders(ctx context.Context, query string, page SearchPage) (SearchResults, error)
+	// FindOrderUIDs ищет заказы по вторичному полю, новые первыми
+	FindOrderUIDs(ctx context.Context, field models.LookupField, value string) ([]string, error)
+	// DeletedOrderUIDs возвращает order_uid заказов, удаленных или архивированных
+	// не раньше since. Удаления помнятся DeletionRetention.
+	DeletedOrderUIDs(ctx context.Context, since time.Time) ([]string, error)
+	// InitDB готовит хранилище к работе
+	InitDB(ctx context.Context) error
+	Close()
+}
+
+// ReadOptions - параметры GetOrderByUID и чтения истории заказа
+type ReadOptions struct {
+	IncludeDeleted bool // вернуть и архивный заказ, с заполненным DeletedAt
+}
+
+// StreamOptions - параметры StreamOrders
+type StreamOptions struct {
+	NewestFirst  bool      // от новых к старым, иначе от старых к новым
+	CreatedSince time.Time // только заказы, записанные в хранилище не раньше, нулевое - все
+	BatchSize    int       // заказов в пачке, 0 - defaultBatchSize
+}
+
+const defaultBatchSize = 500
+
+func (o StreamOptions) batchSize() int {
+	if o.BatchSize > 0 {
+		return o.BatchSize
+	}
+	return defaultBatchSize
+}
+
+// DeletionRetention - сколько хранилище помнит удаленные заказы для DeletedOrderUIDs
+const DeletionRetention = 7 * 24 * time.Hour
+
+// Максимум заказов, возвращаемых поиском по вторичному полю
+const maxLookupResults = 1000
@@ -0,0 +1,128 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+var contextTests = []test{
+	{"expired deadline", testExpiredDeadline},
+	{"canceled context", testCanceled},
+}
+
+// expiredOps вызывает каждую операцию хранилища с ctx и проверяет ее ошибку check
+func expiredOps(t *testing.T, repo repository.OrderRepository, ctx context.Context, check func(error) bool) {
+	t.Helper()
+	order := NewOrder(newUID(), time.Now())
+	type op struct {
+		name string
+		run  func() error
+	}
+	ops := []op{
+		{"save", func() error {
+			_, err := repo.SaveOrder(ctx, order, repository.SaveOptions{})
+			return err
+		}},
+		{"get", func() error {
+			_, err := repo.GetOrderByUID(ctx, order.OrderUID, repository.ReadOptions{})
+			return err
+		}},
+		{"get batch", func() error {
+			_, err := repo.GetOrdersByUIDs(ctx, []string{order.OrderUID})
+			return err
+		}},
+		{"deleted", func() error {
+			_, err := repo.DeletedOrderUIDs(ctx, time.Now())
+			return err
+		}},
+		{"count", func() error {
+			_, err := repo.CountOrders(ctx)
+			return err
+		}},
+		{"find", func() error {
+			_, err := repo.FindOrderUIDs(ctx, models.ByRid, order.Items[0].Rid)
+			return err
+		}},
+		{"list", func() error {
+			_, err := repo.ListOrders(ctx, repository.OrderFilter{}, "", 10)
+			return err
+		}},
+		{"search", func() error {
+			_, err := repo.SearchOrders(ctx, "mascaras", repository.SearchPage{})
+			return err
+		}},
+		{"delete", func() error {
+			return repo.DeleteOrder(ctx, order.OrderUID)
+		}},
+		{"archive", func() error {
+			return repo.ArchiveOrder(ctx, order.OrderUID)
+		}},
+		{"save batch", func() error {
+			_, err := repo.SaveOrdersBatch(ctx, []repository.BatchOrder{{Order: order}}, repository.BatchOptions{})
+			return err
+		}},
+		{"update", func() error {
+			_, err := repo.UpdateOrder(ctx, order, repository.SaveOptions{})
+			return err
+		}},
+		{"history", func() error {
+			_, err := repo.GetOrderHistory(ctx, order.OrderUID, repository.ReadOptions{})
+			return err
+		}},
+		{"raw", func() error {
+			_, err := repo.GetRawOrder(ctx, order.OrderUID)
+			return err
+		}},
+		{"stream raw", func() error {
+			return repo.StreamRawOrders(ctx, repository.RawStreamOptions{}, func(*repository.RawOrder) error {
+				return nil
+			})
+		}},
+		{"stream", func() error {
+			return repo.StreamOrders(ctx, repository.StreamOptions{}, func(*models.Order) error {
+				return nil
+			})
+		}},
+	}
+	if store, ok := repo.(repository.OutboxStore); ok {
+		ops = append(ops, op{"claim outbox", func() error {
+			_, err := store.ClaimOutboxEvents(ctx, repository.ClaimOptions{Limit: 10, Lease: time.Minute, Prefix: order.OrderUID})
+			return err
+		}})
+	}
+	for _, op := range ops {
+		if err := op.run(); !check(err) {
+			t.Errorf("%s: unexpected error %v", op.name, err)
+		}
+	}
+
+	// Ни одна операция не должна была сохранить заказ
+	if _, err := repo.GetOrderByUID(t.Context(), order.OrderUID, repository.ReadOptions{}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("order saved with expired context: %v", err)
+	}
+}
+
+func testExpiredDeadline(t *testing.T, repo repository.OrderRepository) {
+	// Хотя бы один заказ, чтобы чтению было что отдавать
+	save(t, repo, NewOrder(newUID(), time.Now()))
+
+	ctx, cancel := context.WithDeadline(t.Context(), time.Now().Add(-time.Second))
+	defer cancel()
+	expiredOps(t, repo, ctx, func(err error) bool {
+		return errors.Is(err, repository.ErrTimeout)
+	})
+}
+
+func testCanceled(t *testing.T, repo repository.OrderRepository) {
+	save(t, repo, NewOrder(newUID(), time.Now()))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	expiredOps(t, repo, ctx, func(err error) bool {
+		return err != nil && !errors.Is(err, repository.ErrTimeout)
+	})
+}
@@ -0,0 +1,149 @@
+package repotest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+var deleteTests = []test{
+	{"archive hides order", testArchive},
+	{"delete order", testDelete},
+	{"deleted since", testDeletedSince},
+}
+
+func testArchive(t *testing.T, repo repository.OrderRepository) {
+	// Уникальные для запуска покупатель и бренд: чтения идут по всем заказам хранилища
+	word := fmt.Sprintf("arch%d", time.Now().UnixNano())
+	order := NewOrder(newUID(), time.Now())
+	order.CustomerID = word
+	order.Items[0].Brand = word
+	save(t, repo, order)
+	before := count(t, repo)
+
+	// Повторная архивация не ошибка
+	for range 2 {
+		if err := repo.ArchiveOrder(t.Context(), order.OrderUID); err != nil {
+			t.Fatalf("archive: %v", err)
+		}
+	}
+
+	if _, err := repo.GetOrderByUID(t.Context(), order.OrderUID, repository.ReadOptions{}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get archived: want ErrNotFound, got %v", err)
+	}
+	got, err := repo.GetOrderByUID(t.Context(), order.OrderUID, repository.ReadOptions{IncludeDeleted: true})
+	if err != nil {
+		t.Fatalf("get archived with IncludeDeleted: %v", err)
+	}
+	if got.DeletedAt == nil {
+		t.Error("archived order has no deleted_at")
+	}
+	got.DeletedAt = nil
+	checkOrder(t, "archived order", order, got)
+
+	uids, err := repo.FindOrderUIDs(t.Context(), models.ByCustomerID, word)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	checkUIDs(t, "find archived", nil, uids)
+	checkUIDs(t, "list archived", nil, listUIDs(list(t, repo, repository.OrderFilter{CustomerID: word}, "", 0)))
+	checkUIDs(t, "list with IncludeDeleted", []string{order.OrderUID},
+		listUIDs(list(t, repo, repository.OrderFilter{CustomerID: word, IncludeDeleted: true}, "", 0)))
+	checkUIDs(t, "search archived", nil, searchUIDs(search(t, repo, word, repository.SearchPage{})))
+	checkUIDs(t, "stream archived", nil, filter(streamUIDs(t, repo, repository.StreamOptions{}), []string{order.OrderUID}))
+
+	// На общей БД параллельно могут появляться чужие заказы, поэтому проверяется
+	// только то, что архивный заказ не добавился к счетчику
+	if after := count(t, repo); after >= before+1 {
+		t.Errorf("count grew from %d to %d after archiving", before, after)
+	}
+
+	// Совпадающий дубликат не возвращает заказ из архива, замена - возвращает
+	result, err := repo.SaveOrder(t.Context(), order.Clone(), repository.SaveOptions{Policy: repository.SaveReplace})
+	if err != nil || result != repository.SaveDuplicate {
+		t.Fatalf("save duplicate: want %s, got %s (err: %v)", repository.SaveDuplicate, result, err)
+	}
+	if _, err := repo.GetOrderByUID(t.Context(), order.OrderUID, repository.ReadOptions{}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get after duplicate: want ErrNotFound, got %v", err)
+	}
+	changed := order.Clone()
+	changed.TrackNumber = "RESTORED-" + order.OrderUID
+	result, err = repo.SaveOrder(t.Context(), changed, repository.SaveOptions{Policy: repository.SaveReplace})
+	if err != nil || result != repository.SaveReplaced {
+		t.Fatalf("save replace: want %s, got %s (err: %v)", repository.SaveReplaced, result, err)
+	}
+	got, err = repo.GetOrderByUID(t.Context(), order.OrderUID, repository.ReadOptions{})
+	if err != nil {
+		t.Fatalf("get restored: %v", err)
+	}
+	if got.DeletedAt != nil {
+		t.Error("restored order still has deleted_at")
+	}
+
+	if err := repo.ArchiveOrder(t.Context(), newUID()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("archive missing: want ErrNotFound, got %v", err)
+	}
+}
+
+func testDelete(t *testing.T, repo repository.OrderRepository) {
+	order := NewOrder(newUID(), time.Now())
+	save(t, repo, order)
+	if err := repo.DeleteOrder(t.Context(), order.OrderUID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	_, err := repo.GetOrderByUID(t.Context(), order.OrderUID, repository.ReadOptions{IncludeDeleted: true})
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get deleted: want ErrNotFound, got %v", err)
+	}
+	// Товары удалены вместе с заказом
+	uids, err := repo.FindOrderUIDs(t.Context(), models.ByRid, order.Items[0].Rid)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	checkUIDs(t, "find deleted", nil, uids)
+
+	// Удаленный заказ можно сохранить заново
+	save(t, repo, order)
+	if err := repo.DeleteOrder(t.Context(), order.OrderUID); err != nil {
+		t.Fatalf("delete again: %v", err)
+	}
+	if err := repo.DeleteOrder(t.Context(), order.OrderUID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("delete missing: want ErrNotFound, got %v", err)
+	}
+}
+
+// deletedUIDs возвращает order_uid заказов, удаленных не раньше since, по возрастанию
+func deletedUIDs(t *testing.T, repo repository.OrderRepository, since time.Time) []string {
+	t.Helper()
+	uids, err := repo.DeletedOrderUIDs(t.Context(), since)
+	if err != nil {
+		t.Fatalf("deleted orders: %v", err)
+	}
+	slices.Sort(uids)
+	return uids
+}
+
+func testDeletedSince(t *testing.T, repo repository.OrderRepository) {
+	kept, archived, deleted := newUID(), newUID(), newUID()
+	for _, uid := range []string{kept, archived, deleted} {
+		save(t, repo, NewOrder(uid, time.Now()))
+	}
+	if err := repo.ArchiveOrder(t.Context(), archived); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if err := repo.DeleteOrder(t.Context(), deleted); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// Часы приложения и БД могут расходиться, поэтому границы с большим запасом
+	own := []string{kept, archived, deleted}
+	want := []string{archived, deleted}
+	slices.Sort(want)
+	checkUIDs(t, "deleted since", want, filter(deletedUIDs(t, repo, time.Now().Add(-time.Hour)), own))
+	checkUIDs(t, "deleted later", nil, filter(deletedUIDs(t, repo, time.Now().Add(time.Hour)), own))
+}
@@ -0,0 +1,169 @@
+package repotest
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+var historyTests = []test{
+	{"order history", testHistory},
+	{"update missing or archived", testUpdateMissing},
+}
+
+// checkRevision проверяет номер, источник, сообщение и заказ версии.
+// Сообщение сравнивается по значению: JSONB не сохраняет пробелы и порядок ключей.
+func checkRevision(t *testing.T, got repository.Revision, version int, source string, message []byte, order *models.Order) {
+	t.Helper()
+	if got.Version != version || got.Source != source {
+		t.Errorf("want version %d from %q, got version %d from %q", version, source, got.Version, got.Source)
+	}
+	if got.CreatedAt.IsZero() {
+		t.Errorf("version %d: no created_at", version)
+	}
+	var want, have any
+	if message != nil {
+		json.Unmarshal(message, &want)
+	}
+	if got.Message != nil {
+		json.Unmarshal(got.Message, &have)
+	}
+	w, _ := json.Marshal(want)
+	h, _ := json.Marshal(have)
+	if string(w) != string(h) {
+		t.Errorf("version %d: want message %s, got %s", version, w, h)
+	}
+	if err := sameOrder(order, got.Order); err != nil {
+		t.Errorf("version %d: %v", version, err)
+	}
+}
+
+// history возвращает версии заказа
+func history(t *testing.T, repo repository.OrderRepository, orderUID string, opts repository.ReadOptions) []repository.Revision {
+	t.Helper()
+	revisions, err := repo.GetOrderHistory(t.Context(), orderUID, opts)
+	if err != nil {
+		t.Fatalf("history of %s: %v", orderUID, err)
+	}
+	return revisions
+}
+
+func testHistory(t *testing.T, repo repository.OrderRepository) {
+	first := NewOrder(newUID(), time.Now())
+	message, _ := json.Marshal(first)
+	result, err := repo.SaveOrder(t.Context(), first, repository.SaveOptions{Source: "nats", Message: message})
+	if err != nil || result != repository.SaveInserted {
+		t.Fatalf("save: want %s, got %s (err: %v)", repository.SaveInserted, result, err)
+	}
+
+	second := first.Clone()
+	second.Items[0].Status = 300
+	second.Delivery.Address = "Corrected 16"
+	update, err := repo.UpdateOrder(t.Context(), second, repository.SaveOptions{Source: "api"})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if update != (repository.UpdateResult{Version: 2, Changed: true}) {
+		t.Fatalf("update: want version 2 changed, got %+v", update)
+	}
+	checkStored(t, repo, second)
+
+	// Совпадающий заказ новую версию не создает
+	update, err = repo.UpdateOrder(t.Context(), second.Clone(), repository.SaveOptions{Source: "api"})
+	if err != nil || update != (repository.UpdateResult{Version: 2}) {
+		t.Fatalf("identical update: want version 2 unchanged, got %+v (err: %v)", update, err)
+	}
+
+	// Замена через SaveOrder тоже добавляет версию
+	third := second.Clone()
+	third.Payment.Amount += 100
+	result, err = repo.SaveOrder(t.Context(), third, repository.SaveOptions{Policy: repository.SaveReplace})
+	if err != nil || result != repository.SaveReplaced {
+		t.Fatalf("replace: want %s, got %s (err: %v)", repository.SaveReplaced, result, err)
+	}
+
+	revisions := history(t, repo, first.OrderUID, repository.ReadOptions{})
+	want := []struct {
+		source  string
+		message []byte
+		order   *models.Order
+	}{
+		{"nats", message, first},
+		{"api", nil, second},
+		{"", nil, third},
+	}
+	if len(revisions) != len(want) {
+		t.Fatalf("history: want %d versions, got %d", len(want), len(revisions))
+	}
+	for i, w := range want {
+		checkRevision(t, revisions[i], i+1, w.source, w.message, w.order)
+	}
+
+	revision, err := repo.GetOrderRevision(t.Context(), first.OrderUID, 1, repository.ReadOptions{})
+	if err != nil {
+		t.Fatalf("get version 1: %v", err)
+	}
+	checkRevision(t, *revision, 1, "nats", message, first)
+	for _, version := range []int{0, 4} {
+		_, err := repo.GetOrderRevision(t.Context(), first.OrderUID, version, repository.ReadOptions{})
+		if !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("get version %d: want ErrNotFound, got %v", version, err)
+		}
+	}
+
+	// История архивного заказа доступна только явно
+	if err := repo.ArchiveOrder(t.Context(), first.OrderUID); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	if _, err := repo.GetOrderHistory(t.Context(), first.OrderUID, repository.ReadOptions{}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("history of archived: want ErrNotFound, got %v", err)
+	}
+	if n := len(history(t, repo, first.OrderUID, repository.ReadOptions{IncludeDeleted: true})); n != 3 {
+		t.Errorf("history of archived with IncludeDeleted: want 3 versions, got %d", n)
+	}
+
+	// История удаляется вместе с заказом
+	if err := repo.DeleteOrder(t.Context(), first.OrderUID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	save(t, repo, first)
+	revisions = history(t, repo, first.OrderUID, repository.ReadOptions{})
+	if len(revisions) != 1 {
+		t.Fatalf("history after delete: want 1 version, got %d", len(revisions))
+	}
+	checkRevision(t, revisions[0], 1, "", nil, first)
+}
+
+func testUpdateMissing(t *testing.T, repo repository.OrderRepository) {
+	order := NewOrder(newUID(), time.Now())
+	if _, err := repo.UpdateOrder(t.Context(), order, repository.SaveOptions{}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("update missing: want ErrNotFound, got %v", err)
+	}
+	if _, err := repo.GetOrderHistory(t.Context(), order.OrderUID, repository.ReadOptions{}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("history of missing: want ErrNotFound, got %v", err)
+	}
+
+	save(t, repo, order)
+	if err := repo.ArchiveOrder(t.Context(), order.OrderUID); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	changed := order.Clone()
+	changed.TrackNumber = "CHANGED-" + order.OrderUID
+	if _, err := repo.UpdateOrder(t.Context(), changed, repository.SaveOptions{}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("update archived: want ErrNotFound, got %v", err)
+	}
+
+	// Сообщение, которое не JSON, отклоняется до записи
+	other := NewOrder(newUID(), time.Now())
+	_, err := repo.SaveOrder(t.Context(), other, repository.SaveOptions{Message: []byte("not json")})
+	if !errors.Is(err, repository.ErrInvalidMessage) {
+		t.Errorf("save with invalid message: want ErrInvalidMessage, got %v", err)
+	}
+	_, err = repo.GetOrderByUID(t.Context(), other.OrderUID, repository.ReadOptions{})
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get after invalid message: want ErrNotFound, got %v", err)
+	}
+}
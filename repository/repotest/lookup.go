@@ -0,0 +1,286 @@
+package repotest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+var lookupTests = []test{
+	{"find by lookup fields", testFind},
+	{"get orders by uids", testGetOrdersByUIDs},
+	{"list pages", testListPages},
+	{"list filters", testListFilters},
+	{"search", testSearch},
+}
+
+func testFind(t *testing.T, repo repository.OrderRepository) {
+	base := time.Now().Add(-24 * time.Hour)
+	chrtID := time.Now().UnixNano() % 1_000_000_000_000
+	key := newUID()
+
+	older := NewOrder(newUID(), base)
+	newer := NewOrder(newUID(), base.Add(time.Hour))
+	other := NewOrder(newUID(), base.Add(2*time.Hour))
+
+	// older и newer совпадают по всем полям поиска, other - только по трек-номеру товара
+	for _, order := range []*models.Order{older, newer} {
+		order.TrackNumber = "TRACK-" + key
+		order.CustomerID = "customer-" + key
+		order.Items[0].Rid = "rid-" + key
+		order.Items[0].ChrtID = chrtID
+	}
+	other.Items = append(other.Items, other.Items[0])
+	other.Items[1].TrackNumber = "TRACK-" + key
+
+	for _, order := range []*models.Order{older, newer, other} {
+		save(t, repo, order)
+	}
+
+	cases := []struct {
+		field models.LookupField
+		value string
+		want  []string
+	}{
+		{models.ByTrackNumber, "TRACK-" + key, []string{other.OrderUID, newer.OrderUID, older.OrderUID}},
+		{models.ByCustomerID, "customer-" + key, []string{newer.OrderUID, older.OrderUID}},
+		{models.ByRid, "rid-" + key, []string{newer.OrderUID, older.OrderUID}},
+		{models.ByChrtID, strconv.FormatInt(chrtID, 10), []string{newer.OrderUID, older.OrderUID}},
+		{models.ByCustomerID, "missing-" + key, nil},
+	}
+	for _, c := range cases {
+		got, err := repo.FindOrderUIDs(t.Context(), c.field, c.value)
+		if err != nil {
+			t.Errorf("find by %s: %v", c.field, err)
+			continue
+		}
+		checkUIDs(t, "find by "+string(c.field), c.want, got)
+	}
+
+	if _, err := repo.FindOrderUIDs(t.Context(), "unknown", "x"); err == nil {
+		t.Error("find by unknown field: want error")
+	}
+}
+
+func testGetOrdersByUIDs(t *testing.T, repo repository.OrderRepository) {
+	first := NewOrder(newUID(), time.Now())
+	second := NewOrder(newUID(), time.Now())
+	archived := NewOrder(newUID(), time.Now())
+	for _, order := range []*models.Order{first, second, archived} {
+		save(t, repo, order)
+	}
+	if err := repo.ArchiveOrder(t.Context(), archived.OrderUID); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+
+	// Порядок - как в запросе, отсутствующие и архивные пропускаются
+	orders, err := repo.GetOrdersByUIDs(t.Context(), []string{second.OrderUID, newUID(), archived.OrderUID, first.OrderUID})
+	if err != nil {
+		t.Fatalf("get orders: %v", err)
+	}
+	if len(orders) != 2 {
+		t.Fatalf("want 2 orders, got %d", len(orders))
+	}
+	checkOrder(t, "first returned order", second, orders[0])
+	checkOrder(t, "second returned order", first, orders[1])
+
+	orders, err = repo.GetOrdersByUIDs(t.Context(), nil)
+	if err != nil || len(orders) != 0 {
+		t.Errorf("get no orders: want empty, got %d orders (err: %v)", len(orders), err)
+	}
+}
+
+// saveListed сохраняет заказы одного покупателя с датами base + offsets часов
+func saveListed(t *testing.T, repo repository.OrderRepository, customerID string, base time.Time, offsets ...int) []*models.Order {
+	t.Helper()
+	orders := make([]*models.Order, len(offsets))
+	for i, offset := range offsets {
+		orders[i] = NewOrder(newUID(), base.Add(time.Duration(offset)*time.Hour))
+		orders[i].CustomerID = customerID
+		orders[i].Payment.Amount = 100 * (i + 1)
+		save(t, repo, orders[i])
+	}
+	return orders
+}
+
+func listUIDs(page repository.OrderPage) []string {
+	uids := make([]string, len(page.Orders))
+	for i, order := range page.Orders {
+		uids[i] = order.OrderUID
+	}
+	return uids
+}
+
+// list возвращает страницу заказов по фильтру
+func list(t *testing.T, repo repository.OrderRepository, filter repository.OrderFilter, cursor string, limit int) repository.OrderPage {
+	t.Helper()
+	page, err := repo.ListOrders(t.Context(), filter, cursor, limit)
+	if err != nil {
+		t.Fatalf("list %+v: %v", filter, err)
+	}
+	return page
+}
+
+func testListPages(t *testing.T, repo repository.OrderRepository) {
+	customerID := "list-" + newUID()
+	orders := saveListed(t, repo, customerID, time.Now().Add(-24*time.Hour), 0, 3, 1, 4, 2)
+	want := []string{orders[3].OrderUID, orders[1].OrderUID, orders[4].OrderUID, orders[2].OrderUID, orders[0].OrderUID}
+
+	// Страницы по 2 заказа: 2 + 2 + 1, у последней нет курсора
+	filter := repository.OrderFilter{CustomerID: customerID}
+	var got []string
+	cursor := ""
+	for pages := 1; ; pages++ {
+		page := list(t, repo, filter, cursor, 2)
+		got = append(got, listUIDs(page)...)
+		if page.NextCursor == "" {
+			if pages != 3 {
+				t.Fatalf("want 3 pages, got %d", pages)
+			}
+			break
+		}
+		if pages == 3 {
+			t.Fatal("last page has next cursor")
+		}
+		cursor = page.NextCursor
+	}
+	checkUIDs(t, "pages", want, got)
+
+	page := list(t, repo, filter, "", 0)
+	checkUIDs(t, "default limit", want, listUIDs(page))
+	if len(page.Orders) > 0 {
+		checkOrder(t, "first listed order", orders[3], page.Orders[0])
+	}
+
+	if _, err := repo.ListOrders(t.Context(), filter, "not a cursor", 2); !errors.Is(err, repository.ErrInvalidCursor) {
+		t.Errorf("invalid cursor: want ErrInvalidCursor, got %v", err)
+	}
+
+	empty := list(t, repo, repository.OrderFilter{CustomerID: "missing-" + customerID}, "", 2)
+	if empty.Orders == nil || len(empty.Orders) != 0 || empty.NextCursor != "" {
+		t.Errorf("list missing: want empty page, got %+v", empty)
+	}
+}
+
+func testListFilters(t *testing.T, repo repository.OrderRepository) {
+	customerID := "list-" + newUID()
+	base := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	orders := saveListed(t, repo, customerID, base, 0, 1, 2, 3)
+
+	// Суммы orders: 100, 200, 300, 400. odd отличается полями заказа и платежа
+	// и брендом второго товара
+	odd := NewOrder(newUID(), base.Add(5*time.Hour))
+	odd.CustomerID = customerID
+	odd.DeliveryService = "dhl-" + customerID
+	odd.Locale = "ru"
+	odd.Entry = "WBRU"
+	odd.Payment.Provider = "sbp"
+	odd.Payment.Bank = "sber"
+	odd.Payment.Currency = "RUB"
+	odd.Payment.Amount = 1000
+	odd.Items = append(odd.Items, odd.Items[0])
+	odd.Items[1].Brand = "brand-" + customerID
+	save(t, repo, odd)
+
+	amount := func(v int) *int { return &v }
+	uid := func(i int) string { return orders[i].OrderUID }
+	cases := []struct {
+		name   string
+		filter repository.OrderFilter
+		want   []string
+	}{
+		{"created range", repository.OrderFilter{CreatedFrom: base.Add(time.Hour), CreatedTo: base.Add(3 * time.Hour)}, []string{uid(2), uid(1)}},
+		{"amount range", repository.OrderFilter{AmountMin: amount(200), AmountMax: amount(300)}, []string{uid(2), uid(1)}},
+		{"amount min", repository.OrderFilter{AmountMin: amount(400)}, []string{odd.OrderUID, uid(3)}},
+		{"delivery service", repository.OrderFilter{DeliveryService: odd.DeliveryService}, []string{odd.OrderUID}},
+		{"locale and entry", repository.OrderFilter{Locale: "ru", Entry: "WBRU"}, []string{odd.OrderUID}},
+		{"payment", repository.OrderFilter{Provider: "sbp", Bank: "sber", Currency: "RUB"}, []string{odd.OrderUID}},
+		{"other payment", repository.OrderFilter{Provider: "wbpay", Currency: "RUB"}, nil},
+		{"brand", repository.OrderFilter{Brand: "brand-" + customerID}, []string{odd.OrderUID}},
+		{"common brand", repository.OrderFilter{Brand: "Vivienne Sabo", AmountMax: amount(100)}, []string{uid(0)}},
+	}
+	for _, c := range cases {
+		c.filter.CustomerID = customerID
+		checkUIDs(t, c.name, c.want, listUIDs(list(t, repo, c.filter, "", 10)))
+	}
+}
+
+func searchUIDs(results repository.SearchResults) []string {
+	uids := make([]string, len(results.Results))
+	for i, result := range results.Results {
+		uids[i] = result.Order.OrderUID
+	}
+	return uids
+}
+
+// search возвращает результаты полнотекстового поиска
+func search(t *testing.T, repo repository.OrderRepository, query string, page repository.SearchPage) repository.SearchResults {
+	t.Helper()
+	results, err := repo.SearchOrders(t.Context(), query, page)
+	if err != nil {
+		t.Fatalf("search %q: %v", query, err)
+	}
+	return results
+}
+
+func testSearch(t *testing.T, repo repository.OrderRepository) {
+	// Уникальное для запуска слово: поиск идет по всем заказам хранилища
+	word := fmt.Sprintf("srch%d", time.Now().UnixNano())
+
+	inItem := NewOrder(newUID(), time.Now())
+	inItem.Items[0].Brand = strings.ToUpper(word) + " Cosmetics"
+	inDelivery := NewOrder(newUID(), time.Now())
+	inDelivery.Delivery.City = word + "grad"
+	inDelivery.Delivery.Address = "<b>" + word + "</b> 15"
+	for _, order := range []*models.Order{inItem, inDelivery, NewOrder(newUID(), time.Now())} {
+		save(t, repo, order)
+	}
+
+	// Совпадение в товаре важнее совпадения в доставке
+	results := search(t, repo, word, repository.SearchPage{})
+	want := []string{inItem.OrderUID, inDelivery.OrderUID}
+	checkUIDs(t, "search", want, searchUIDs(results))
+	if len(results.Results) != 2 {
+		t.FailNow()
+	}
+	if results.Results[0].Rank <= results.Results[1].Rank {
+		t.Errorf("item match ranked %g, delivery match %g", results.Results[0].Rank, results.Results[1].Rank)
+	}
+	checkOrder(t, "found order", inItem, results.Results[0].Order)
+
+	wantHighlights := [][]repository.Highlight{
+		{{Field: "items[0].brand", Text: "<mark>" + strings.ToUpper(word) + "</mark> Cosmetics"}},
+		{
+			{Field: "delivery.city", Text: "<mark>" + word + "grad</mark>"},
+			{Field: "delivery.address", Text: "&lt;b&gt;<mark>" + word + "</mark>&lt;/b&gt; 15"},
+		},
+	}
+	for i, want := range wantHighlights {
+		got, _ := json.Marshal(results.Results[i].Highlights)
+		wantJSON, _ := json.Marshal(want)
+		if string(got) != string(wantJSON) {
+			t.Errorf("highlights: want %s, got %s", wantJSON, got)
+		}
+	}
+
+	// Слова ищутся во всех полях заказа сразу
+	results = search(t, repo, "Mascaras "+word, repository.SearchPage{})
+	checkUIDs(t, "search two words", want, searchUIDs(results))
+
+	first := search(t, repo, word, repository.SearchPage{Limit: 1})
+	second := search(t, repo, word, repository.SearchPage{Offset: first.NextOffset, Limit: 1})
+	checkUIDs(t, "search pages", want, append(searchUIDs(first), searchUIDs(second)...))
+	if first.NextOffset != 1 || second.NextOffset != 0 {
+		t.Errorf("search pages: want next offsets 1 and 0, got %d and %d", first.NextOffset, second.NextOffset)
+	}
+
+	if _, err := repo.SearchOrders(t.Context(), " !? ", repository.SearchPage{}); !errors.Is(err, repository.ErrInvalidQuery) {
+		t.Errorf("empty query: want ErrInvalidQuery, got %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package repotest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+var outboxTests = []test{
+	{"outbox events", testOutbox},
+	{"save batch", testSaveBatch},
+}
+
+// outboxStore возвращает хранилище как OutboxStore
+func outboxStore(t *testing.T, repo repository.OrderRepository) repository.OutboxStore {
+	t.Helper()
+	store, ok := repo.(repository.OutboxStore)
+	if !ok {
+		t.Fatalf("%T does not implement repository.OutboxStore", repo)
+	}
+	return store
+}
+
+// claimed резервирует события заказов с префиксом и сверяет их с want
+// (order_uid:тип:версия) по порядку
+func claimed(t *testing.T, store repository.OutboxStore, prefix string, want ...string) []repository.OutboxEvent {
+	t.Helper()
+	events, err := store.ClaimOutboxEvents(t.Context(), repository.ClaimOptions{Limit: 10, Lease: time.Minute, Prefix: prefix})
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	got := make([]string, len(events))
+	for i, event := range events {
+		got[i] = fmt.Sprintf("%s:%s:%d", event.OrderUID, event.Type, event.Version)
+	}
+	checkUIDs(t, "claimed events", want, got)
+	if len(got) != len(want) {
+		t.FailNow()
+	}
+	return events
+}
+
+// markSent отмечает события отправленными
+func markSent(t *testing.T, store repository.OutboxStore, ids ...int64) {
+	t.Helper()
+	if err := store.MarkOutboxSent(t.Context(), ids); err != nil {
+		t.Fatalf("mark sent: %v", err)
+	}
+}
+
+func testOutbox(t *testing.T, repo repository.OrderRepository) {
+	store := outboxStore(t, repo)
+
+	// Свой префикс: события других проверок не мешают
+	prefix := newUID() + "-"
+	first := NewOrder(prefix+"a", time.Now())
+	second := NewOrder(prefix+"b", time.Now())
+	event := func(order *models.Order, eventType string, version int) string {
+		return fmt.Sprintf("%s:%s:%d", order.OrderUID, eventType, version)
+	}
+
+	// Вставка, изменение и замена пишут события, дубликат - нет
+	save(t, repo, first)
+	if _, err := repo.SaveOrder(t.Context(), first, repository.SaveOptions{}); err != nil {
+		t.Fatalf("save duplicate: %v", err)
+	}
+	updated := first.Clone()
+	updated.TrackNumber = "UPDATED-" + first.OrderUID
+	if _, err := repo.UpdateOrder(t.Context(), updated, repository.SaveOptions{}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	replaced := first.Clone()
+	replaced.TrackNumber = "REPLACED-" + first.OrderUID
+	if _, err := repo.SaveOrder(t.Context(), replaced, repository.SaveOptions{Policy: repository.SaveReplace}); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	save(t, repo, second)
+
+	// Событие заказа выдается только после отправки предыдущих
+	events := claimed(t, store, prefix,
+		event(first, repository.EventOrderCreated, 1), event(second, repository.EventOrderCreated, 1))
+	var payload repository.OrderEvent
+	if err := json.Unmarshal(events[0].Payload, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.Type != repository.EventOrderCreated || payload.OrderUID != first.OrderUID || payload.Version != 1 || payload.Order == nil {
+		t.Fatalf("unexpected payload %s", events[0].Payload)
+	}
+	checkOrder(t, "payload order", first, payload.Order)
+	if events[0].Attempts != 1 {
+		t.Errorf("want 1 attempt, got %d", events[0].Attempts)
+	}
+
+	// Зарезервированные события не выдаются повторно до конца резерва
+	claimed(t, store, prefix)
+
+	// После ошибки событие выдается снова, когда наступит retryAt
+	if err := store.MarkOutboxFailed(t.Context(), events[0].ID, time.Now().Add(-time.Second), "publish failed"); err != nil {
+		t.Fatalf("mark failed: %v", err)
+	}
+	retried := claimed(t, store, prefix, event(first, repository.EventOrderCreated, 1))
+	if retried[0].Attempts != 2 {
+		t.Errorf("want 2 attempts, got %d", retried[0].Attempts)
+	}
+
+	// Отправленные события больше не выдаются, открывая следующие версии
+	markSent(t, store, events[0].ID, events[1].ID)
+	next := claimed(t, store, prefix, event(first, repository.EventOrderUpdated, 2))
+	markSent(t, store, next[0].ID)
+	last := claimed(t, store, prefix, event(first, repository.EventOrderUpdated, 3))
+	if err := json.Unmarshal(last[0].Payload, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	checkOrder(t, "replaced payload order", replaced, payload.Order)
+	markSent(t, store, last[0].ID)
+	claimed(t, store, prefix)
+}
+
+func testSaveBatch(t *testing.T, repo repository.OrderRepository) {
+	// Свой префикс: события outbox других проверок не мешают
+	prefix := newUID() + "-"
+	word := fmt.Sprintf("batch%d", time.Now().UnixNano())
+	newOrder := func(name string) *models.Order {
+		return NewOrder(prefix+name, time.Now())
+	}
+
+	withMessage := newOrder("a")
+	withMessage.Items[0].Brand = word
+	plain := newOrder("b")
+	duplicate := newOrder("c")
+	conflicting := newOrder("d")
+	save(t, repo, duplicate)
+	save(t, repo, conflicting)
+	changed := conflicting.Clone()
+	changed.TrackNumber = "CHANGED-" + conflicting.OrderUID
+	changedInBatch := plain.Clone()
+	changedInBatch.TrackNumber = "CHANGED-" + plain.OrderUID
+	foreignPayment := newOrder("e")
+	foreignPayment.Payment.Transaction = plain.OrderUID
+
+	batch := []repository.BatchOrder{
+		{Order: withMessage, Message: rawMessage(withMessage, map[string]any{"future_field": "kept"})},
+		{Order: plain},
+		{Order: duplicate},
+		{Order: changed},
+		{Order: withMessage},
+		{Order: changedInBatch},
+		{Order: newOrder("f"), Message: []byte("not json")},
+		{Order: foreignPayment},
+		{Order: nil},
+	}
+	result, err := repo.SaveOrdersBatch(t.Context(), batch, repository.BatchOptions{})
+	if err != nil {
+		t.Fatalf("save batch: %v", err)
+	}
+	if result.Inserted != 2 || result.Duplicates != 2 {
+		t.Errorf("want 2 inserted and 2 duplicates, got %d and %d", result.Inserted, result.Duplicates)
+	}
+
+	// Отклоненные - по порядку в пачке, с причиной
+	wantRejected := []struct {
+		index int
+		err   error
+	}{
+		{3, repository.ErrConflict},
+		{5, repository.ErrConflict},
+		{6, repository.ErrInvalidMessage},
+		{7, repository.ErrInvalidOrder},
+		{8, repository.ErrInvalidOrder},
+	}
+	if len(result.Rejected) != len(wantRejected) {
+		t.Fatalf("want %d rejected, got %+v", len(wantRejected), result.Rejected)
+	}
+	for i, want := range wantRejected {
+		got := result.Rejected[i]
+		if got.Index != want.index || !errors.Is(got.Err, want.err) {
+			t.Errorf("rejected %d: want index %d with %v, got %d with %v", i, want.index, want.err, got.Index, got.Err)
+			continue
+		}
+		if batch[got.Index].Order != nil && got.OrderUID != batch[got.Index].Order.OrderUID {
+			t.Errorf("rejected %d: want order_uid %s, got %s", i, batch[got.Index].Order.OrderUID, got.OrderUID)
+		}
+	}
+
+	// Записанные заказы полны и доступны всем чтениям
+	for _, want := range []*models.Order{withMessage, plain, duplicate, conflicting} {
+		checkStored(t, repo, want)
+	}
+	if _, err := repo.GetOrderByUID(t.Context(), prefix+"f", repository.ReadOptions{}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("get rejected order: want ErrNotFound, got %v", err)
+	}
+	checkUIDs(t, "search", []string{withMessage.OrderUID}, searchUIDs(search(t, repo, word, repository.SearchPage{})))
+
+	// Версия 1 с источником import, сообщение - в raw_orders
+	revisions := history(t, repo, withMessage.OrderUID, repository.ReadOptions{})
+	if len(revisions) != 1 {
+		t.Fatalf("want 1 revision, got %d", len(revisions))
+	}
+	checkRevision(t, revisions[0], 1, repository.ImportSource, batch[0].Message, withMessage)
+	if got := rawField(rawOrder(t, repo, withMessage.OrderUID), "future_field"); got != "kept" {
+		t.Errorf("raw payload: want future_field kept, got %v", got)
+	}
+	checkNoRaw(t, repo, "raw without message", plain.OrderUID)
+
+	// События order.created - только для вставленных заказов
+	claimed(t, outboxStore(t, repo), prefix,
+		fmt.Sprintf("%s:%s:1", duplicate.OrderUID, repository.EventOrderCreated),
+		fmt.Sprintf("%s:%s:1", conflicting.OrderUID, repository.EventOrderCreated),
+		fmt.Sprintf("%s:%s:1", withMessage.OrderUID, repository.EventOrderCreated),
+		fmt.Sprintf("%s:%s:1", plain.OrderUID, repository.EventOrderCreated))
+
+	// Пустая пачка ничего не пишет
+	result, err = repo.SaveOrdersBatch(t.Context(), nil, repository.BatchOptions{})
+	if err != nil || result.Inserted != 0 || len(result.Rejected) != 0 {
+		t.Errorf("empty batch: got %+v (err: %v)", result, err)
+	}
+}
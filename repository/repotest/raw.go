@@ -0,0 +1,167 @@
+package repotest
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+var rawTests = []test{
+	{"raw orders", testRawOrders},
+	{"rederive", testRederive},
+}
+
+// rawMessage возвращает JSON заказа с дополнительными полями сообщения
+func rawMessage(order *models.Order, extra map[string]any) []byte {
+	data, _ := json.Marshal(order)
+	fields := map[string]any{}
+	json.Unmarshal(data, &fields)
+	for key, value := range extra {
+		fields[key] = value
+	}
+	data, _ = json.Marshal(fields)
+	return data
+}
+
+// rawField возвращает поле сохраненного исходного сообщения
+func rawField(raw *repository.RawOrder, key string) any {
+	fields := map[string]any{}
+	json.Unmarshal(raw.Payload, &fields)
+	return fields[key]
+}
+
+// rawOrder возвращает исходное сообщение заказа
+func rawOrder(t *testing.T, repo repository.OrderRepository, orderUID string) *repository.RawOrder {
+	t.Helper()
+	raw, err := repo.GetRawOrder(t.Context(), orderUID)
+	if err != nil {
+		t.Fatalf("get raw %s: %v", orderUID, err)
+	}
+	return raw
+}
+
+// checkNoRaw проверяет, что у заказа нет исходного сообщения
+func checkNoRaw(t *testing.T, repo repository.OrderRepository, what, orderUID string) {
+	t.Helper()
+	if _, err := repo.GetRawOrder(t.Context(), orderUID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("%s: want ErrNotFound, got %v", what, err)
+	}
+}
+
+func testRawOrders(t *testing.T, repo repository.OrderRepository) {
+	order := NewOrder(newUID(), time.Now())
+	timestamp := time.Now().UTC().Truncate(time.Second)
+	opts := repository.SaveOptions{
+		Source:    "nats",
+		Message:   rawMessage(order, map[string]any{"future_field": "kept"}),
+		Sequence:  42,
+		Timestamp: timestamp,
+	}
+	if _, err := repo.SaveOrder(t.Context(), order, opts); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// Поля, которых нет в модели, сохраняются
+	raw := rawOrder(t, repo, order.OrderUID)
+	if raw.OrderUID != order.OrderUID || raw.Sequence != 42 || !raw.Timestamp.Equal(timestamp) || raw.ReceivedAt.IsZero() {
+		t.Errorf("raw order: want %s seq 42 at %s, got %s seq %d at %s (received %s)",
+			order.OrderUID, timestamp, raw.OrderUID, raw.Sequence, raw.Timestamp, raw.ReceivedAt)
+	}
+	if got := rawField(raw, "future_field"); got != "kept" {
+		t.Errorf("raw payload: want future_field kept, got %v", got)
+	}
+
+	// Повторная доставка не заменяет сообщение
+	opts.Message = rawMessage(order, map[string]any{"future_field": "redelivered"})
+	opts.Sequence = 43
+	if _, err := repo.SaveOrder(t.Context(), order, opts); err != nil {
+		t.Fatalf("save duplicate: %v", err)
+	}
+	if raw := rawOrder(t, repo, order.OrderUID); raw.Sequence != 42 {
+		t.Errorf("raw after duplicate: want seq 42, got %+v", raw)
+	}
+
+	// Заказ без сообщения получает его при повторной доставке
+	legacy := NewOrder(newUID(), time.Now())
+	save(t, repo, legacy)
+	checkNoRaw(t, repo, "raw without message", legacy.OrderUID)
+	if _, err := repo.SaveOrder(t.Context(), legacy, repository.SaveOptions{Message: rawMessage(legacy, nil)}); err != nil {
+		t.Fatalf("redeliver: %v", err)
+	}
+	rawOrder(t, repo, legacy.OrderUID)
+
+	// Изменение без сообщения отвязывает заказ от старого сообщения
+	changed := order.Clone()
+	changed.TrackNumber = "CHANGED-" + order.OrderUID
+	if _, err := repo.UpdateOrder(t.Context(), changed, repository.SaveOptions{Source: "api"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	checkNoRaw(t, repo, "raw after update without message", order.OrderUID)
+
+	// Сообщение удаляется вместе с заказом
+	if err := repo.DeleteOrder(t.Context(), legacy.OrderUID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	checkNoRaw(t, repo, "raw after delete", legacy.OrderUID)
+}
+
+func testRederive(t *testing.T, repo repository.OrderRepository) {
+	// Свой префикс: пересобираются только заказы этой проверки
+	prefix := newUID() + "-"
+	newOrder := func(name string) *models.Order {
+		return NewOrder(prefix+name, time.Now())
+	}
+
+	// Сообщение расходится с таблицами, как после добавления поля в модель
+	stale := newOrder("1")
+	fresh := stale.Clone()
+	fresh.Shardkey = "7"
+	same := newOrder("2")
+	archived := newOrder("3")
+	invalid := newOrder("4")
+	saves := []struct {
+		order   *models.Order
+		message []byte
+	}{
+		{stale, rawMessage(fresh, map[string]any{"future_field": 1})},
+		{same, rawMessage(same, nil)},
+		{archived, rawMessage(fresh, map[string]any{"order_uid": archived.OrderUID})},
+		{invalid, rawMessage(invalid, map[string]any{"order_uid": "other"})},
+	}
+	for _, s := range saves {
+		if _, err := repo.SaveOrder(t.Context(), s.order, repository.SaveOptions{Message: s.message}); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+	if err := repo.ArchiveOrder(t.Context(), archived.OrderUID); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+
+	want := repository.RederiveStats{Total: 4, Changed: 1, Unchanged: 1, Archived: 1, Invalid: 1}
+	stats, err := repository.Rederive(t.Context(), repo, repository.RederiveOptions{Prefix: prefix, DryRun: true})
+	if err != nil || stats != want {
+		t.Fatalf("dry run: want %+v, got %+v (err: %v)", want, stats, err)
+	}
+	checkStored(t, repo, stale)
+
+	stats, err = repository.Rederive(t.Context(), repo, repository.RederiveOptions{Prefix: prefix})
+	if err != nil || stats != want {
+		t.Fatalf("rederive: want %+v, got %+v (err: %v)", want, stats, err)
+	}
+	checkStored(t, repo, fresh)
+	revisions := history(t, repo, stale.OrderUID, repository.ReadOptions{})
+	checkRevision(t, revisions[len(revisions)-1], 2, repository.RederiveSource, nil, fresh)
+
+	// Сообщение остается: пересборка повторяема
+	if got := rawField(rawOrder(t, repo, stale.OrderUID), "future_field"); got != 1.0 {
+		t.Errorf("raw after rederive: want future_field 1, got %v", got)
+	}
+	want = repository.RederiveStats{Total: 4, Unchanged: 2, Archived: 1, Invalid: 1}
+	stats, err = repository.Rederive(t.Context(), repo, repository.RederiveOptions{Prefix: prefix})
+	if err != nil || stats != want {
+		t.Errorf("second rederive: want %+v, got %+v (err: %v)", want, stats, err)
+	}
+}
@@ -0,0 +1,193 @@
+// Package repotest - общий набор проверок контракта repository.OrderRepository.
+// Каждая реализация хранилища должна проходить его целиком, см. memory_test.go
+// и postgres_test.go в пакете repository:
+//
+//	go test -race ./repository
+//	REPOTEST_POSTGRES_DSN=postgres://... go test ./repository
+//
+// Проверки сгруппированы по файлам пакета: сохранение, чтение потоком,
+// поиск, удаление, история, исходные сообщения, outbox и таймауты.
+package repotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+// test - одна проверка контракта на свежем хранилище
+type test struct {
+	name string
+	run  func(t *testing.T, repo repository.OrderRepository)
+}
+
+// groups - все проверки контракта по группам
+var groups = []struct {
+	name  string
+	tests []test
+}{
+	{"save", saveTests},
+	{"stream", streamTests},
+	{"lookup", lookupTests},
+	{"delete", deleteTests},
+	{"history", historyTests},
+	{"raw", rawTests},
+	{"outbox", outboxTests},
+	{"context", contextTests},
+}
+
+// Run выполняет все проверки подтестами t. newRepo создает хранилище для
+// каждой проверки, после нее хранилище закрывается.
+func Run(t *testing.T, newRepo func() repository.OrderRepository) {
+	for _, group := range groups {
+		t.Run(group.name, func(t *testing.T) {
+			for _, test := range group.tests {
+				t.Run(test.name, func(t *testing.T) {
+					repo := newRepo()
+					defer repo.Close()
+					if err := repo.InitDB(t.Context()); err != nil {
+						t.Fatalf("failed to init repository: %v", err)
+					}
+					test.run(t, repo)
+				})
+			}
+		})
+	}
+}
+
+var (
+	// Префикс order_uid запуска: набор можно гонять на общей БД с чужими заказами
+	runPrefix = fmt.Sprintf("repotest-%d-", time.Now().UnixNano())
+	uidSeq    atomic.Int64
+)
+
+// newUID возвращает новый уникальный order_uid
+func newUID() string {
+	return fmt.Sprintf("%s%04d", runPrefix, uidSeq.Add(1))
+}
+
+// NewOrder возвращает корректный заказ с указанными order_uid и датой создания
+func NewOrder(orderUID string, created time.Time) *models.Order {
+	return &models.Order{
+		OrderUID:        orderUID,
+		TrackNumber:     "TRACK-" + orderUID,
+		Entry:           "WBIL",
+		Locale:          "en",
+		CustomerID:      "customer-" + orderUID,
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     created.UTC().Truncate(time.Second),
+		OofShard:        "1",
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction:  orderUID,
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDt:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []models.Item{
+			{
+				ChrtID:      9934930,
+				TrackNumber: "TRACK-" + orderUID,
+				Price:       453,
+				Rid:         "rid-" + orderUID,
+				Name:        "Mascaras",
+				Sale:        30,
+				Size:        "0",
+				TotalPrice:  317,
+				NmID:        2389212,
+				Brand:       "Vivienne Sabo",
+				Status:      202,
+			},
+		},
+	}
+}
+
+// save сохраняет новый заказ с политикой по умолчанию
+func save(t *testing.T, repo repository.OrderRepository, order *models.Order) {
+	t.Helper()
+	result, err := repo.SaveOrder(t.Context(), order, repository.SaveOptions{})
+	if err != nil {
+		t.Fatalf("save %s: %v", order.OrderUID, err)
+	}
+	if result != repository.SaveInserted {
+		t.Fatalf("save %s: want %s, got %s", order.OrderUID, repository.SaveInserted, result)
+	}
+}
+
+// sameOrder сравнивает заказы по JSON-представлению, время - как момент
+func sameOrder(want, got *models.Order) error {
+	if got == nil {
+		return fmt.Errorf("got nil order")
+	}
+	if !want.DateCreated.Equal(got.DateCreated) {
+		return fmt.Errorf("date_created: want %s, got %s", want.DateCreated, got.DateCreated)
+	}
+
+	w, g := *want, *got
+	w.DateCreated, g.DateCreated = time.Time{}, time.Time{}
+	wantJSON, _ := json.Marshal(w)
+	gotJSON, _ := json.Marshal(g)
+	if string(wantJSON) != string(gotJSON) {
+		return fmt.Errorf("order mismatch:\nwant %s\ngot  %s", wantJSON, gotJSON)
+	}
+	return nil
+}
+
+// checkOrder проверяет, что got совпадает с want
+func checkOrder(t *testing.T, what string, want, got *models.Order) {
+	t.Helper()
+	if err := sameOrder(want, got); err != nil {
+		t.Errorf("%s: %v", what, err)
+	}
+}
+
+// checkStored проверяет, что в хранилище лежит want
+func checkStored(t *testing.T, repo repository.OrderRepository, want *models.Order) {
+	t.Helper()
+	got, err := repo.GetOrderByUID(t.Context(), want.OrderUID, repository.ReadOptions{})
+	if err != nil {
+		t.Fatalf("get %s: %v", want.OrderUID, err)
+	}
+	checkOrder(t, "stored order", want, got)
+}
+
+// checkUIDs проверяет список order_uid с учетом порядка
+func checkUIDs(t *testing.T, what string, want, got []string) {
+	t.Helper()
+	if strings.Join(want, ",") != strings.Join(got, ",") {
+		t.Errorf("%s: want %v, got %v", what, want, got)
+	}
+}
+
+// filter оставляет в got только значения из set, сохраняя порядок got
+func filter(got, set []string) []string {
+	var result []string
+	for _, v := range got {
+		for _, s := range set {
+			if v == s {
+				result = append(result, v)
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,187 @@
+package repotest
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+var saveTests = []test{
+	{"save and get", testSaveAndGet},
+	{"get missing", testGetMissing},
+	{"identical duplicate skipped", testIdenticalDuplicate},
+	{"conflict rejected", testConflictRejected},
+	{"conflict kept", testConflictKept},
+	{"conflict replaced", testConflictReplaced},
+	{"concurrent duplicate saves", testConcurrentDuplicates},
+	{"orders are copies", testCopies},
+	{"items keep order", testItemsOrder},
+	{"concurrent access", testConcurrent},
+}
+
+func testSaveAndGet(t *testing.T, repo repository.OrderRepository) {
+	order := NewOrder(newUID(), time.Now())
+	save(t, repo, order)
+	checkStored(t, repo, order)
+}
+
+func testGetMissing(t *testing.T, repo repository.OrderRepository) {
+	_, err := repo.GetOrderByUID(t.Context(), newUID(), repository.ReadOptions{})
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+}
+
+// saveConflict сохраняет заказ, затем отличающийся заказ с тем же order_uid
+// с политикой policy и возвращает оба заказа и результат второго сохранения
+func saveConflict(t *testing.T, repo repository.OrderRepository, policy repository.SavePolicy) (first, second *models.Order, result repository.SaveResult, err error) {
+	t.Helper()
+	first = NewOrder(newUID(), time.Now())
+	save(t, repo, first)
+
+	second = first.Clone()
+	second.TrackNumber = "CHANGED-" + first.OrderUID
+	second.Items[0].Rid = "changed-rid-" + first.OrderUID
+	second.Items = append(second.Items, second.Items[0])
+	second.Items[1].Name = "Added"
+
+	result, err = repo.SaveOrder(t.Context(), second, repository.SaveOptions{Policy: policy})
+	return first, second, result, err
+}
+
+func testIdenticalDuplicate(t *testing.T, repo repository.OrderRepository) {
+	order := NewOrder(newUID(), time.Now())
+	save(t, repo, order)
+
+	for _, policy := range []repository.SavePolicy{repository.SaveReject, repository.SaveSkip, repository.SaveReplace} {
+		result, err := repo.SaveOrder(t.Context(), order.Clone(), repository.SaveOptions{Policy: policy})
+		if err != nil || result != repository.SaveDuplicate {
+			t.Errorf("policy %s: want %s, got %s (err: %v)", policy, repository.SaveDuplicate, result, err)
+		}
+	}
+	checkStored(t, repo, order)
+}
+
+func testConflictRejected(t *testing.T, repo repository.OrderRepository) {
+	first, _, _, err := saveConflict(t, repo, repository.SaveReject)
+	if !errors.Is(err, repository.ErrConflict) {
+		t.Fatalf("want ErrConflict, got %v", err)
+	}
+	checkStored(t, repo, first)
+}
+
+func testConflictKept(t *testing.T, repo repository.OrderRepository) {
+	first, _, result, err := saveConflict(t, repo, repository.SaveSkip)
+	if err != nil || result != repository.SaveKept {
+		t.Fatalf("want %s, got %s (err: %v)", repository.SaveKept, result, err)
+	}
+	checkStored(t, repo, first)
+}
+
+func testConflictReplaced(t *testing.T, repo repository.OrderRepository) {
+	first, second, result, err := saveConflict(t, repo, repository.SaveReplace)
+	if err != nil || result != repository.SaveReplaced {
+		t.Fatalf("want %s, got %s (err: %v)", repository.SaveReplaced, result, err)
+	}
+	checkStored(t, repo, second)
+
+	// Старые товары удалены вместе с заказом, а не дописаны к новым
+	got, err := repo.FindOrderUIDs(t.Context(), models.ByRid, first.Items[0].Rid)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	checkUIDs(t, "find by replaced rid", nil, got)
+}
+
+func testConcurrentDuplicates(t *testing.T, repo repository.OrderRepository) {
+	const workers = 8
+	order := NewOrder(newUID(), time.Now())
+
+	var (
+		wg       sync.WaitGroup
+		inserted atomic.Int32
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := repo.SaveOrder(t.Context(), order.Clone(), repository.SaveOptions{})
+			switch {
+			case err != nil:
+				t.Errorf("save: %v", err)
+			case result == repository.SaveInserted:
+				inserted.Add(1)
+			case result != repository.SaveDuplicate:
+				t.Errorf("want %s or %s, got %s", repository.SaveInserted, repository.SaveDuplicate, result)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := inserted.Load(); n != 1 {
+		t.Fatalf("order inserted %d times", n)
+	}
+	checkStored(t, repo, order)
+}
+
+func testCopies(t *testing.T, repo repository.OrderRepository) {
+	order := NewOrder(newUID(), time.Now())
+	want := order.Clone()
+	save(t, repo, order)
+
+	// Изменение сохраненного и полученного заказов не должно влиять на хранилище
+	order.TrackNumber = "CHANGED"
+	order.Items[0].Name = "CHANGED"
+	got, err := repo.GetOrderByUID(t.Context(), want.OrderUID, repository.ReadOptions{})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	got.Items[0].Name = "CHANGED"
+
+	checkStored(t, repo, want)
+}
+
+func testItemsOrder(t *testing.T, repo repository.OrderRepository) {
+	order := NewOrder(newUID(), time.Now())
+	for i := 1; i <= 3; i++ {
+		item := order.Items[0]
+		item.Name = "item-" + strconv.Itoa(i)
+		item.ChrtID += int64(i)
+		order.Items = append(order.Items, item)
+	}
+	save(t, repo, order)
+	checkStored(t, repo, order)
+}
+
+func testConcurrent(t *testing.T, repo repository.OrderRepository) {
+	const workers, perWorker = 8, 10
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				order := NewOrder(newUID(), time.Now())
+				result, err := repo.SaveOrder(t.Context(), order, repository.SaveOptions{})
+				if err != nil || result != repository.SaveInserted {
+					t.Errorf("save %s: want %s, got %s (err: %v)", order.OrderUID, repository.SaveInserted, result, err)
+					continue
+				}
+				got, err := repo.GetOrderByUID(t.Context(), order.OrderUID, repository.ReadOptions{})
+				if err == nil {
+					err = sameOrder(order, got)
+				}
+				if err != nil {
+					t.Errorf("get %s: %v", order.OrderUID, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,139 @@
+package repotest
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+var streamTests = []test{
+	{"all orders oldest first", testAllOrders},
+	{"stream in batches", testStreamBatches},
+	{"stream newest first", testStreamNewestFirst},
+	{"stream created since", testStreamCreatedSince},
+	{"stream stops on error", testStreamStop},
+	{"count orders", testCount},
+}
+
+// saveAged сохраняет заказы с датами создания base+offsets[i] часов
+func saveAged(t *testing.T, repo repository.OrderRepository, base time.Time, offsets ...int) []string {
+	t.Helper()
+	orderUIDs := make([]string, len(offsets))
+	for i, offset := range offsets {
+		orderUIDs[i] = newUID()
+		save(t, repo, NewOrder(orderUIDs[i], base.Add(time.Duration(offset)*time.Hour)))
+	}
+	return orderUIDs
+}
+
+// streamUIDs возвращает order_uid всех заказов из StreamOrders
+func streamUIDs(t *testing.T, repo repository.OrderRepository, opts repository.StreamOptions) []string {
+	t.Helper()
+	var orderUIDs []string
+	err := repo.StreamOrders(t.Context(), opts, func(order *models.Order) error {
+		orderUIDs = append(orderUIDs, order.OrderUID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	return orderUIDs
+}
+
+func testAllOrders(t *testing.T, repo repository.OrderRepository) {
+	uids := saveAged(t, repo, time.Now().Add(-24*time.Hour), 2, 0, 1)
+
+	orders, err := repo.GetAllOrders(t.Context())
+	if err != nil {
+		t.Fatalf("get all: %v", err)
+	}
+	got := make([]string, 0, len(orders))
+	for _, order := range orders {
+		got = append(got, order.OrderUID)
+	}
+
+	// В хранилище могут быть и другие заказы, проверяем порядок только своих
+	checkUIDs(t, "oldest first", []string{uids[1], uids[2], uids[0]}, filter(got, uids))
+}
+
+func testStreamBatches(t *testing.T, repo repository.OrderRepository) {
+	uids := saveAged(t, repo, time.Now().Add(-48*time.Hour), 4, 0, 3, 1, 2)
+
+	// Пачки по 2 заказа: порядок не должен нарушаться на границах пачек,
+	// а заказы с товарами - приходить целиком
+	var got []string
+	err := repo.StreamOrders(t.Context(), repository.StreamOptions{BatchSize: 2}, func(order *models.Order) error {
+		if len(filter([]string{order.OrderUID}, uids)) == 1 {
+			checkOrder(t, "streamed order", NewOrder(order.OrderUID, order.DateCreated), order)
+		}
+		got = append(got, order.OrderUID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	checkUIDs(t, "oldest first", []string{uids[1], uids[3], uids[4], uids[2], uids[0]}, filter(got, uids))
+}
+
+func testStreamNewestFirst(t *testing.T, repo repository.OrderRepository) {
+	uids := saveAged(t, repo, time.Now().Add(-24*time.Hour), 1, 2, 0)
+
+	got := streamUIDs(t, repo, repository.StreamOptions{NewestFirst: true, BatchSize: 2})
+	checkUIDs(t, "newest first", []string{uids[1], uids[0], uids[2]}, filter(got, uids))
+}
+
+func testStreamCreatedSince(t *testing.T, repo repository.OrderRepository) {
+	// date_created в прошлом, но записан в хранилище сейчас
+	order := NewOrder(newUID(), time.Now().Add(-24*time.Hour))
+	save(t, repo, order)
+
+	// Часы приложения и БД могут расходиться, поэтому границы с большим запасом
+	got := streamUIDs(t, repo, repository.StreamOptions{CreatedSince: time.Now().Add(-time.Hour)})
+	if len(filter(got, []string{order.OrderUID})) != 1 {
+		t.Error("order saved after since not returned")
+	}
+	got = streamUIDs(t, repo, repository.StreamOptions{CreatedSince: time.Now().Add(time.Hour)})
+	if len(filter(got, []string{order.OrderUID})) != 0 {
+		t.Error("order saved before since returned")
+	}
+}
+
+func testStreamStop(t *testing.T, repo repository.OrderRepository) {
+	saveAged(t, repo, time.Now(), 0, 1, 2)
+
+	errStop := errors.New("stop")
+	calls := 0
+	err := repo.StreamOrders(t.Context(), repository.StreamOptions{BatchSize: 2}, func(*models.Order) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("want error from fn, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("fn called %d times after error", calls)
+	}
+}
+
+// count возвращает число заказов в хранилище
+func count(t *testing.T, repo repository.OrderRepository) int {
+	t.Helper()
+	n, err := repo.CountOrders(t.Context())
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	return n
+}
+
+func testCount(t *testing.T, repo repository.OrderRepository) {
+	before := count(t, repo)
+	saveAged(t, repo, time.Now(), 0, 0)
+
+	// На общей БД параллельно могут появляться чужие заказы
+	if after := count(t, repo); after-before < 2 {
+		t.Fatalf("count grew by %d after saving 2 orders", after-before)
+	}
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+	"wb-orders-service/models"
+)
+
+// ErrInvalidMessage возвращается, если исходное сообщение для истории не JSON
+var ErrInvalidMessage = errors.New("invalid source message")
+
+// Revision - версия заказа в истории изменений
+type Revision struct {
+	Version   int             `json:"version"` // 1, 2, ... в порядке записи
+	CreatedAt time.Time       `json:"created_at"`
+	Source    string          `json:"source,omitempty"`  // откуда пришла версия: nats, api, ...
+	Message   json.RawMessage `json:"message,omitempty"` // исходное сообщение
+	Order     *models.Order   `json:"order"`             // заказ в этой версии
+}
+
+// clone возвращает независимую копию версии
+func (r Revision) clone() Revision {
+	r.Message = bytes.Clone(r.Message)
+	r.Order = r.Order.Clone()
+	return r
+}
+
+// UpdateResult - результат UpdateOrder
+type UpdateResult struct {
+	Version int  `json:"version"` // текущая версия заказа
+	Changed bool `json:"changed"` // false - заказ совпал с текущей версией, новая не создана
+}
+
+// revisionSource - источник версии заказа из SaveOptions
+type revisionSource struct {
+	name      string
+	message   json.RawMessage // nil - сообщения нет
+	sequence  uint64
+	timestamp time.Time
+}
+
+// newRevisionSource проверяет исходное сообщение из opts
+func newRevisionSource(opts SaveOptions) (revisionSource, error) {
+	if opts.Message != nil && !json.Valid(opts.Message) {
+		return revisionSource{}, ErrInvalidMessage
+	}
+	return revisionSource{
+		name:      opts.Source,
+		message:   opts.Message,
+		sequence:  opts.Sequence,
+		timestamp: opts.Timestamp,
+	}, nil
+}
+
+// raw возвращает исходное сообщение заказа для raw_orders, nil - сообщения нет
+func (s revisionSource) raw(orderUID string) *RawOrder {
+	if s.message == nil {
+		return nil
+	}
+	return &RawOrder{
+		OrderUID:   orderUID,
+		Payload:    bytes.Clone(s.message),
+		Sequence:   s.sequence,
+		Timestamp:  s.timestamp,
+		ReceivedAt: time.Now(),
+	}
+}
+
+// keepsRaw сообщает, что запись без сообщения не отвязывает заказ от raw_orders:
+// Rederive записывает заказ, разобранный из того же сообщения
+func (s revisionSource) keepsRaw() bool {
+	return s.name == RederiveSource
+}
+
+// revisionOrder возвращает заказ в виде для истории: без DeletedAt, который
+// относится к заказу, а не к версии
+func revisionOrder(order *models.Order) *models.Order {
+	c := order.Clone()
+	c.DeletedAt = nil
+	return c
+}
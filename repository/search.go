@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"wb-orders-service/models"
+)
+
+// Размер страницы SearchOrders и ограничение на число слов запроса
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+	maxSearchTerms     = 8
+)
+
+// ErrInvalidQuery возвращается, если в поисковом запросе нет ни одного слова
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// Веса полей при ранжировании, как setweight A и B в миграции 0005:
+// совпадение в товаре важнее совпадения в доставке
+const (
+	searchWeightItem     = 1.0
+	searchWeightDelivery = 0.4
+)
+
+// SearchPage - страница результатов поиска. Результаты упорядочены по
+// релевантности, поэтому страницы задаются смещением, а не курсором.
+type SearchPage struct {
+	Offset int
+	Limit  int // 0 - DefaultSearchLimit, больше MaxSearchLimit обрезается
+}
+
+func (p SearchPage) limit() int {
+	if p.Limit <= 0 {
+		return DefaultSearchLimit
+	}
+	return min(p.Limit, MaxSearchLimit)
+}
+
+// SearchResult - найденный заказ
+type SearchResult struct {
+	Order      *models.Order `json:"order"`
+	Rank       float64       `json:"rank"`
+	Highlights []Highlight   `json:"highlights"`
+}
+
+// Highlight - поле заказа с совпавшими словами, обернутыми в <mark>.
+// Текст поля экранирован для вставки в HTML.
+type Highlight struct {
+	Field string `json:"field"` // items[0].brand, delivery.city, ...
+	Text  string `json:"text"`
+}
+
+// SearchResults - страница SearchOrders
+type SearchResults struct {
+	Results []SearchResult `json:"results"`
+	// Смещение следующей страницы, 0 - страница последняя
+	NextOffset int `json:"next_offset,omitempty"`
+}
+
+// searchTerms разбивает запрос на слова в нижнем регистре. Каждое слово
+// ищется как префикс слова в заказе, поэтому "Kiryat Moz" находит "Kiryat Mozkin".
+func searchTerms(query string) ([]string, error) {
+	terms := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: no words to search", ErrInvalidQuery)
+	}
+	if len(terms) > maxSearchTerms {
+		return nil, fmt.Errorf("%w: at most %d words", ErrInvalidQuery, maxSearchTerms)
+	}
+	return terms, nil
+}
+
+// tsQuery собирает запрос to_tsquery: все слова как префиксы. Слова состоят
+// только из букв и цифр, поэтому синтаксис tsquery в них не встречается.
+func tsQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = term + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// searchField - поле заказа, участвующее в поиске
+type searchField struct {
+	name   string
+	text   string
+	weight float64
+}
+
+func searchFields(order *models.Order) []searchField {
+	fields := make([]searchField, 0, 2*len(order.Items)+3)
+	for i, item := range order.Items {
+		fields = append(fields,
+			searchField{fmt.Sprintf("items[%d].name", i), item.Name, searchWeightItem},
+			searchField{fmt.Sprintf("items[%d].brand", i), item.Brand, searchWeightItem},
+		)
+	}
+	return append(fields,
+		searchField{"delivery.name", order.Delivery.Name, searchWeightDelivery},
+		searchField{"delivery.city", order.Delivery.City, searchWeightDelivery},
+		searchField{"delivery.address", order.Delivery.Address, searchWeightDelivery},
+	)
+}
+
+// matchOrder проверяет, что каждое слово запроса есть в заказе, и возвращает
+// упрощенный ранг: средний вес лучшего поля по словам запроса
+func matchOrder(order *models.Order, terms []string) (rank float64, ok bool) {
+	fields := searchFields(order)
+	for _, term := range terms {
+		best := 0.0
+		for _, field := range fields {
+			if field.weight > best && containsPrefix(field.text, term) {
+				best = field.weight
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		rank += best
+	}
+	return rank / float64(len(terms)), true
+}
+
+// highlight возвращает поля заказа, в которых есть слова запроса
+func highlight(order *models.Order, terms []string) []Highlight {
+	highlights := []Highlight{}
+	for _, field := range searchFields(order) {
+		if text, ok := markTerms(field.text, terms); ok {
+			highlights = append(highlights, Highlight{Field: field.name, Text: text})
+		}
+	}
+	return highlights
+}
+
+// containsPrefix сообщает, начинается ли какое-нибудь слово text с term
+func containsPrefix(text, term string) bool {
+	_, ok := markTerms(text, []string{term})
+	return ok
+}
+
+// markTerms экранирует text и оборачивает в <mark> слова, начинающиеся с одного из terms
+func markTerms(text string, terms []string) (string, bool) {
+	var b strings.Builder
+	marked := false
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			b.WriteString(html.EscapeString(string(runes[i])))
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		if hasTermPrefix(strings.ToLower(word), terms) {
+			b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+			marked = true
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+		i = j
+	}
+	return b.String(), marked
+}
+
+func hasTermPrefix(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+	"wb-orders-service/logging"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+// tombstoneTTL - сколько помнить запись или удаление заказа. Загрузка из БД
+// или прогрев, начатые раньше, не должны положить в кэш устаревший заказ;
+// дольше они не длятся.
+const tombstoneTTL = 10 * time.Minute
+
+// tombstones - недавно записанные, удаленные или архивированные заказы. Кэш
+// обновляется под mu, поэтому заказ, прочитанный из БД до записи или удаления,
+// не попадает в кэш после них.
+type tombstones struct {
+	mu      sync.Mutex
+	changed map[string]time.Time // order_uid -> время записи или удаления
+	swept   time.Time            // когда из changed последний раз убирались старые отметки
+}
+
+// add отмечает запись или удаление заказа и выполняет evict под той же блокировкой
+func (t *tombstones) add(orderUID string, evict func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if t.changed == nil {
+		t.changed = make(map[string]time.Time)
+	}
+	if now.Sub(t.swept) > tombstoneTTL {
+		for uid, at := range t.changed {
+			if now.Sub(at) > tombstoneTTL {
+				delete(t.changed, uid)
+			}
+		}
+		t.swept = now
+	}
+	t.changed[orderUID] = now
+	evict()
+}
+
+// cacheUnlessChanged выполняет set, если заказ не записывали и не удаляли
+// после since - начала чтения. Более ранняя отметка забывается: прочитана
+// уже версия после нее.
+func (t *tombstones) cacheUnlessChanged(orderUID string, since time.Time, set func()) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if at, ok := t.changed[orderUID]; ok {
+		if !at.Before(since) {
+			return false
+		}
+		delete(t.changed, orderUID)
+	}
+	set()
+	return true
+}
+
+// evictSince вызывает evict для заказов, записанных или удаленных не раньше since
+func (t *tombstones) evictSince(since time.Time, evict func(orderUID string)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for uid, at := range t.changed {
+		if !at.Before(since) {
+			evict(uid)
+		}
+	}
+}
+
+// DeleteOrder удаляет заказ из БД и убирает его из кэша
+func (s *OrderService) DeleteOrder(ctx context.Context, orderUID string) error {
+	if err := s.repo.DeleteOrder(ctx, orderUID); err != nil {
+		return err
+	}
+
+	s.invalidate(orderUID)
+	logging.Infof("Order %s deleted", orderUID)
+	return nil
+}
+
+// ArchiveOrder помечает заказ удаленным (deleted_at) и убирает его из кэша.
+// Архивный заказ скрыт из чтений, но доступен через GetOrderIncludingDeleted.
+func (s *OrderService) ArchiveOrder(ctx context.Context, orderUID string) error {
+	if err := s.repo.ArchiveOrder(ctx, orderUID); err != nil {
+		return err
+	}
+
+	s.invalidate(orderUID)
+	logging.Infof("Order %s archived", orderUID)
+	return nil
+}
+
+// GetOrderIncludingDeleted возвращает заказ из БД, даже если он архивирован.
+// Кэш не используется: архивные заказы в нем не хранятся.
+func (s *OrderService) GetOrderIncludingDeleted(ctx context.Context, orderUID string) (*models.Order, error) {
+	return s.repo.GetOrderByUID(ctx, orderUID, repository.ReadOptions{IncludeDeleted: true})
+}
+
+// invalidate убирает записанный или удаленный заказ из кэша. Загрузки,
+// начатые раньше, его не вернут; следующее чтение загрузит заказ из БД.
+// Действует только на кэш этого экземпляра: другие экземпляры сервиса с той
+// же БД отдают заказ из своего кэша до вытеснения или истечения TTL.
+func (s *OrderService) invalidate(orderUID string) {
+	s.changed.add(orderUID, func() {
+		s.cache.Delete(orderUID)
+	})
+}
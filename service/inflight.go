@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"wb-orders-service/models"
+)
+
+// loadGroup объединяет одновременные загрузки одного заказа из БД:
+// запрос выполняет первый вызвавший, остальные ждут его результат
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+type loadCall struct {
+	done  chan struct{}
+	order *models.Order
+	err   error
+}
+
+// Do выполняет load для key, если такая загрузка еще не идет, иначе ждет текущую.
+// Загрузка выполняется независимо от ожидающих: отмена ctx прерывает только
+// ожидание вызывающего, а результат достанется остальным. shared = true, если
+// вызов присоединился к уже идущей загрузке.
+func (g *loadGroup) Do(ctx context.Context, key string, load func() (*models.Order, error)) (order *models.Order, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*loadCall)
+	}
+	call, shared := g.calls[key]
+	if !shared {
+		call = &loadCall{done: make(chan struct{})}
+		g.calls[key] = call
+		go g.run(key, call, load)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.order, shared, call.err
+	case <-ctx.Done():
+		return nil, shared, ctx.Err()
+	}
+}
+
+func (g *loadGroup) run(key string, call *loadCall, load func() (*models.Order, error)) {
+	call.order, call.err = load()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	close(call.done)
+}
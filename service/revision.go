@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"wb-orders-service/logging"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+// UpdateOrder записывает новую версию существующего заказа и убирает прежнюю из кэша.
+// Заказ, совпадающий с текущей версией, новую версию не создает.
+func (s *OrderService) UpdateOrder(ctx context.Context, order *models.Order, opts repository.SaveOptions) (repository.UpdateResult, error) {
+	result, err := s.repo.UpdateOrder(ctx, order, opts)
+	if err != nil {
+		return result, err
+	}
+	if !result.Changed {
+		logging.Debugf("Order %s matches version %d, update skipped", order.OrderUID, result.Version)
+		return result, nil
+	}
+
+	s.invalidate(order.OrderUID)
+	logging.Infof("Order %s updated to version %d", order.OrderUID, result.Version)
+	return result, nil
+}
+
+// GetOrderHistory возвращает версии заказа от первой к последней. История
+// читается из БД: в кэше хранится только текущая версия.
+func (s *OrderService) GetOrderHistory(ctx context.Context, orderUID string, opts repository.ReadOptions) ([]repository.Revision, error) {
+	return s.repo.GetOrderHistory(ctx, orderUID, opts)
+}
+
+// GetOrderRevision возвращает версию заказа из БД
+func (s *OrderService) GetOrderRevision(ctx context.Context, orderUID string, version int, opts repository.ReadOptions) (*repository.Revision, error) {
+	return s.repo.GetOrderRevision(ctx, orderUID, version, opts)
+}
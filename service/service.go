@@ -1,79 +1,263 @@
 package service
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 	"wb-orders-service/cache"
+	"wb-orders-service/logging"
 	"wb-orders-service/models"
 	"wb-orders-service/repository"
 )
 
+// Options - настройки сервиса заказов
+type Options struct {
+	Cache cache.Options
+
+	// Заказы, созданные раньше чем OldOrderAge назад, хранятся в кэше
+	// OldOrderTTL вместо cache.Options.TTL. 0 - не различать.
+	OldOrderAge time.Duration
+	OldOrderTTL time.Duration
+
+	// Кэш отсутствующих order_uid. NegativeTTL = 0 - отключен.
+	NegativeMaxEntries int
+	NegativeTTL        time.Duration
+
+	// Снимок кэша на диске для быстрого перезапуска. Пустой путь - снимки отключены.
+	SnapshotPath     string
+	SnapshotInterval time.Duration // 0 - только при остановке
+	SnapshotMaxAge   time.Duration // более старый снимок игнорируется, 0 - без ограничения
+
+	// Доля загруженных при прогреве заказов, после которой сервис считается
+	// готовым. 1 - только после завершения прогрева, 0 - сразу.
+	WarmupReadyRatio float64
+}
+
+// ErrInvalidLookup возвращается при некорректном значении для поиска
+var ErrInvalidLookup = errors.New("invalid lookup value")
+
 type OrderService struct {
-	repo  *repository.PostgresRepository
-	cache *cache.Cache
+	repo     repository.OrderRepository
+	cache    cache.Store
+	negative *cache.Negative
+	opts     atomic.Pointer[Options]
+
+	counters serviceCounters
+	loads    loadGroup
+	warmup   warmup
+	changed  tombstones
+
+	// ctx живет до Close: фоновые задачи и общие загрузки из БД
+	// не зависят от отмены запросов, которые их вызвали
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	closeOnce sync.Once
 }
 
-func NewOrderService(repo *repository.PostgresRepository) *OrderService {
+func NewOrderService(repo repository.OrderRepository, opts Options) *OrderService {
 	service := &OrderService{
-		repo:  repo,
-		cache: cache.New(),
+		repo:     repo,
+		cache:    cache.NewStore(opts.Cache),
+		negative: cache.NewNegative(opts.NegativeMaxEntries, opts.NegativeTTL),
 	}
+	service.ctx, service.cancel = context.WithCancel(context.Background())
+	service.opts.Store(&opts)
+	service.warmup.state = WarmupLoading
+	service.warmup.started = time.Now()
 
-	// Восстанавливаем кэш из БД при создании сервиса
-	if err := service.restoreCache(); err != nil {
-		log.Printf("Warning: failed to restore cache: %v", err)
+	// Кэш прогревается в фоне из снимка или БД, ход прогрева - WarmupStatus
+	service.wg.Add(1)
+	go service.warmupLoop()
+
+	if opts.SnapshotPath != "" && opts.SnapshotInterval > 0 {
+		service.wg.Add(1)
+		go service.snapshotLoop(opts.SnapshotInterval)
 	}
 
 	return service
 }
 
-// restoreCache загружает все заказы из БД в кэш
-func (s *OrderService) restoreCache() error {
-	orders, err := s.repo.GetAllOrders()
+// SaveOrder сохраняет заказ в БД и убирает прежнюю версию из кэша. Если заказ с таким order_uid
+// уже есть, действует opts.Policy; совпадающий дубликат пропускается без ошибки.
+func (s *OrderService) SaveOrder(ctx context.Context, order *models.Order, opts repository.SaveOptions) (repository.SaveResult, error) {
+	// Сохраняем в БД
+	result, err := s.repo.SaveOrder(ctx, order, opts)
 	if err != nil {
-		return err
+		return result, err
 	}
 
-	for i := range orders {
-		s.cache.Set(&orders[i])
+	switch result {
+	case repository.SaveDuplicate:
+		logging.Debugf("Order %s is already saved, duplicate skipped", order.OrderUID)
+		return result, nil
+	case repository.SaveKept:
+		// В кэше должен остаться заказ из БД, а не отброшенный
+		logging.Warnf("Order %s differs from the saved one, kept the saved order", order.OrderUID)
+		return result, nil
 	}
 
-	log.Printf("Cache restored with %d orders", len(orders))
-	return nil
+	// Заказ больше не считается отсутствующим; прежняя версия убирается из кэша,
+	// новая загрузится из БД при чтении
+	s.negative.Remove(order.OrderUID)
+	s.invalidate(order.OrderUID)
+
+	logging.Infof("Order %s saved to DB (%s)", order.OrderUID, result)
+	return result, nil
 }
 
-// SaveOrder сохраняет заказ в БД и обновляет кэш
-func (s *OrderService) SaveOrder(order *models.Order) error {
-	// Сохраняем в БД
-	if err := s.repo.SaveOrder(order); err != nil {
-		return err
+// GetOrder возвращает заказ из кэша или БД. Одновременные промахи по одному
+// order_uid выполняют один запрос к БД, отмена ctx прерывает только ожидание.
+// Истечение дедлайна ctx возвращает ошибку, для которой errors.Is(err, repository.ErrTimeout).
+func (s *OrderService) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	// Пробуем получить из кэша (быстро)
+	if order, exists := s.cache.Get(orderUID); exists {
+		logging.Debugf("Order %s found in cache", orderUID)
+		return order, nil
 	}
 
-	// Обновляем кэш
-	s.cache.Set(order)
+	// Недавно уже искали в БД и не нашли
+	if s.negative.Contains(orderUID) {
+		s.counters.negativeHits.Add(1)
+		return nil, fmt.Errorf("%w: %s", repository.ErrNotFound, orderUID)
+	}
 
-	log.Printf("Order %s saved to DB and cache", order.OrderUID)
-	return nil
-}
+	// Если нет в кэше (не загружался или вытеснен), ищем в БД
+	order, shared, err := s.loads.Do(ctx, orderUID, func() (*models.Order, error) {
+		generation := s.negative.Generation()
+		start := time.Now()
+		order, err := s.repo.GetOrderByUID(s.ctx, orderUID, repository.ReadOptions{})
+		s.counters.observeLoad(time.Since(start), err)
+		if errors.Is(err, repository.ErrNotFound) {
+			s.negative.Add(orderUID, generation)
+		}
+		if err != nil {
+			return nil, err
+		}
 
-// GetOrder возвращает заказ из кэша или БД
-func (s *OrderService) GetOrder(orderUID string) (*models.Order, error) {
-	// Пробуем получить из кэша (быстро)
-	if order, exists := s.cache.Get(orderUID); exists {
-		log.Printf("Order %s found in cache", orderUID)
+		// Сохраняем в кэш для будущих запросов, если заказ не записали и не удалили во время чтения
+		if s.cacheLoaded(order, start) {
+			logging.Debugf("Order %s loaded from DB and cached", orderUID)
+		}
 		return order, nil
+	})
+	if shared {
+		s.counters.deduplicated.Add(1)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, &repository.TimeoutError{Op: "get order", Err: err}
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Если нет в кэше, ищем в БД
-	order, err := s.repo.GetOrderByUID(orderUID)
+	// Загруженный заказ достается всем ожидавшим, каждому нужна своя копия
+	return order.Clone(), nil
+}
+
+// FindOrders ищет заказы по вторичному полю. Список order_uid всегда берется
+// из БД: в кэше может быть только часть подходящих заказов (не загружены или
+// вытеснены). Заказы берутся из кэша, недостающие загружаются из БД одним чтением.
+func (s *OrderService) FindOrders(ctx context.Context, field models.LookupField, value string) ([]*models.Order, error) {
+	if field == models.ByChrtID {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: chrt_id must be an integer", ErrInvalidLookup)
+		}
+	}
+
+	orderUIDs, err := s.repo.FindOrderUIDs(ctx, field, value)
 	if err != nil {
 		return nil, err
 	}
 
-	// Сохраняем в кэш для будущих запросов
-	s.cache.Set(order)
-	log.Printf("Order %s loaded from DB and cached", orderUID)
+	found := make(map[string]*models.Order, len(orderUIDs))
+	var missing []string
+	for _, orderUID := range orderUIDs {
+		if order, exists := s.cache.Get(orderUID); exists {
+			found[orderUID] = order
+		} else {
+			missing = append(missing, orderUID)
+		}
+	}
+	if len(missing) > 0 {
+		start := time.Now()
+		loaded, err := s.repo.GetOrdersByUIDs(ctx, missing)
+		s.counters.observeLoad(time.Since(start), err)
+		if err != nil {
+			return nil, err
+		}
+		for _, order := range loaded {
+			s.cacheLoaded(order, start)
+			found[order.OrderUID] = order
+		}
+	}
+
+	orders := make([]*models.Order, 0, len(orderUIDs))
+	for _, orderUID := range orderUIDs {
+		// Заказа нет, если его удалили между запросами
+		if order, ok := found[orderUID]; ok {
+			orders = append(orders, order)
+		}
+	}
+
+	logging.Debugf("Found %d orders by %s=%s, %d loaded from DB", len(orders), field, value, len(missing))
+	return orders, nil
+}
+
+// ListOrders возвращает страницу заказов по фильтру. Страницы читаются из БД:
+// в кэше может быть только часть заказов, подходящих под фильтр.
+func (s *OrderService) ListOrders(ctx context.Context, filter repository.OrderFilter, cursor string, limit int) (repository.OrderPage, error) {
+	return s.repo.ListOrders(ctx, filter, cursor, limit)
+}
+
+// SearchOrders ищет заказы по тексту в товарах и доставке, самые релевантные первыми
+func (s *OrderService) SearchOrders(ctx context.Context, query string, page repository.SearchPage) (repository.SearchResults, error) {
+	return s.repo.SearchOrders(ctx, query, page)
+}
+
+// cacheOrder сохраняет заказ в кэш со временем жизни, зависящим от его возраста
+func (s *OrderService) cacheOrder(order *models.Order) {
+	s.cache.SetWithTTL(order, s.orderTTL(order))
+}
+
+// cacheLoaded сохраняет в кэш заказ, прочитанный из БД начиная со start, если
+// его не записали и не удалили после start. Запись заказа не кладет его в кэш,
+// а убирает из него (invalidate): иначе чтение, начатое до записи, могло бы
+// вернуть в кэш прежнюю версию.
+func (s *OrderService) cacheLoaded(order *models.Order, start time.Time) bool {
+	return s.changed.cacheUnlessChanged(order.OrderUID, start, func() {
+		s.cacheOrder(order)
+	})
+}
+
+// orderTTL возвращает время жизни заказа в кэше, 0 - значение по умолчанию
+func (s *OrderService) orderTTL(order *models.Order) time.Duration {
+	opts := s.opts.Load()
+	if opts.OldOrderAge > 0 && opts.OldOrderTTL > 0 && time.Since(order.DateCreated) > opts.OldOrderAge {
+		return opts.OldOrderTTL
+	}
+	return 0
+}
+
+// SetOptions применяет новые настройки кэша без перезапуска
+func (s *OrderService) SetOptions(opts Options) {
+	s.opts.Store(&opts)
+	s.cache.SetOptions(opts.Cache)
+	s.negative.SetLimits(opts.NegativeMaxEntries, opts.NegativeTTL)
+}
 
-	return order, nil
+// Close останавливает фоновые задачи сервиса и сохраняет снимок кэша
+func (s *OrderService) Close() {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		s.wg.Wait()
+		s.SaveSnapshot()
+		s.cache.Close()
+	})
 }
 
 // GetCacheSize возвращает размер кэша
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+	"wb-orders-service/cache"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+	"wb-orders-service/repository/repotest"
+)
+
+// slowReadRepo задерживает GetOrderByUID: чтение возвращает заказ,
+// прочитанный до закрытия release
+type slowReadRepo struct {
+	*repository.MemoryRepository
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (r *slowReadRepo) GetOrderByUID(ctx context.Context, orderUID string, opts repository.ReadOptions) (*models.Order, error) {
+	order, err := r.MemoryRepository.GetOrderByUID(ctx, orderUID, opts)
+	close(r.read)
+	<-r.release
+	return order, err
+}
+
+func waitWarmup(t *testing.T, svc *OrderService) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !svc.warmup.done() {
+		if time.Now().After(deadline) {
+			t.Fatal("cache warm-up did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGetOrderDoesNotCacheStaleLoad(t *testing.T) {
+	ctx := context.Background()
+	repo := &slowReadRepo{
+		MemoryRepository: repository.NewMemoryRepository(),
+		read:             make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	order := repotest.NewOrder("stale-load", time.Now())
+	if _, err := repo.SaveOrder(ctx, order, repository.SaveOptions{}); err != nil {
+		t.Fatalf("failed to save order: %v", err)
+	}
+
+	svc := NewOrderService(repo, Options{})
+	defer svc.Close()
+	waitWarmup(t, svc)
+	svc.cache.Clear()
+
+	loaded := make(chan error, 1)
+	go func() {
+		_, err := svc.GetOrder(ctx, order.OrderUID)
+		loaded <- err
+	}()
+
+	// Заказ обновляется, пока прежняя версия читается из БД
+	<-repo.read
+	updated := order.Clone()
+	updated.TrackNumber = "TRACK-UPDATED"
+	if _, err := svc.UpdateOrder(ctx, updated, repository.SaveOptions{}); err != nil {
+		t.Fatalf("failed to update order: %v", err)
+	}
+	close(repo.release)
+	if err := <-loaded; err != nil {
+		t.Fatalf("failed to get order: %v", err)
+	}
+
+	if cached, ok := svc.cache.Get(order.OrderUID); ok && cached.TrackNumber != "TRACK-UPDATED" {
+		t.Fatalf("stale version cached: track_number = %q", cached.TrackNumber)
+	}
+}
+
+func TestFindOrdersAfterEviction(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	base := time.Now().Add(-time.Hour)
+	for i, uid := range []string{"find-1", "find-2", "find-3"} {
+		order := repotest.NewOrder(uid, base.Add(time.Duration(i)*time.Minute))
+		order.CustomerID = "customer-find"
+		if _, err := repo.SaveOrder(ctx, order, repository.SaveOptions{}); err != nil {
+			t.Fatalf("failed to save order: %v", err)
+		}
+	}
+
+	svc := NewOrderService(repo, Options{Cache: cache.Options{MaxEntries: 1}})
+	defer svc.Close()
+	waitWarmup(t, svc)
+
+	// Два заказа из трех не поместились в кэш и загружаются одним чтением
+	loads := svc.counters.dbFallbacks.Load()
+	orders, err := svc.FindOrders(ctx, models.ByCustomerID, "customer-find")
+	if err != nil {
+		t.Fatalf("failed to find orders: %v", err)
+	}
+	var got []string
+	for _, order := range orders {
+		got = append(got, order.OrderUID)
+	}
+	if want := []string{"find-3", "find-2", "find-1"}; !slices.Equal(got, want) {
+		t.Fatalf("found %v, want %v", got, want)
+	}
+	if n := svc.counters.dbFallbacks.Load() - loads; n != 1 {
+		t.Errorf("orders loaded from DB in %d reads, want 1", n)
+	}
+}
+
+func TestSnapshotDoesNotRestoreDeletedOrders(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	for _, uid := range []string{"snap-kept", "snap-archived", "snap-deleted"} {
+		if _, err := repo.SaveOrder(ctx, repotest.NewOrder(uid, time.Now()), repository.SaveOptions{}); err != nil {
+			t.Fatalf("failed to save order: %v", err)
+		}
+	}
+
+	opts := Options{SnapshotPath: filepath.Join(t.TempDir(), "cache.snapshot")}
+	first := NewOrderService(repo, opts)
+	defer first.Close()
+	waitWarmup(t, first)
+	if err := first.SaveSnapshot(); err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+	if err := first.ArchiveOrder(ctx, "snap-archived"); err != nil {
+		t.Fatalf("failed to archive order: %v", err)
+	}
+	if err := first.DeleteOrder(ctx, "snap-deleted"); err != nil {
+		t.Fatalf("failed to delete order: %v", err)
+	}
+	if _, err := os.Stat(opts.SnapshotPath); err != nil {
+		t.Fatalf("snapshot removed after delete: %v", err)
+	}
+
+	// Второй экземпляр стартует без остановки первого, как после сбоя
+	second := NewOrderService(repo, opts)
+	defer second.Close()
+	waitWarmup(t, second)
+	if source := second.WarmupStatus().Source; source != "snapshot" {
+		t.Fatalf("cache warmed from %s, want snapshot", source)
+	}
+
+	if _, err := second.GetOrder(ctx, "snap-kept"); err != nil {
+		t.Fatalf("failed to get order: %v", err)
+	}
+	for _, uid := range []string{"snap-archived", "snap-deleted"} {
+		if _, err := second.GetOrder(ctx, uid); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("order %s: want ErrNotFound, got %v", uid, err)
+		}
+	}
+}
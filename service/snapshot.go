@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"time"
+	"wb-orders-service/logging"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+// Запас на расхождение часов приложения и БД и на заказы, которые уже
+// записаны в БД, но еще не попали в кэш в момент снимка
+const snapshotWatermarkMargin = time.Minute
+
+// restoreFromSnapshot загружает снимок кэша, догружает из БД заказы, записанные
+// после него, и убирает удаленные после него. Возвращает false, если нужна
+// полная загрузка: снимка нет, он поврежден, устарел или догрузка не удалась.
+func (s *OrderService) restoreFromSnapshot() bool {
+	opts := s.opts.Load()
+
+	s.warmup.begin("snapshot")
+	start := time.Now()
+	info, err := s.cache.LoadSnapshotFile(opts.SnapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		logging.Infof("Cache snapshot %s not found, loading all orders", opts.SnapshotPath)
+		return false
+	}
+	if err != nil {
+		logging.Warnf("Failed to load cache snapshot, loading all orders: %v", err)
+		return false
+	}
+
+	if opts.SnapshotMaxAge > 0 && time.Since(info.CreatedAt) > opts.SnapshotMaxAge {
+		logging.Warnf("Cache snapshot from %s is stale, loading all orders", info.CreatedAt.Format(time.RFC3339))
+		s.cache.Clear()
+		return false
+	}
+
+	// Журнал удалений хранится DeletionRetention: по более старому снимку
+	// нельзя узнать все удаленные после него заказы
+	if time.Since(info.Watermark) > repository.DeletionRetention-snapshotWatermarkMargin {
+		logging.Warnf("Cache snapshot from %s is older than deletion log, loading all orders", info.CreatedAt.Format(time.RFC3339))
+		s.cache.Clear()
+		return false
+	}
+
+	since := info.Watermark.Add(-snapshotWatermarkMargin)
+	newer := 0
+	err = s.repo.StreamOrders(s.ctx, repository.StreamOptions{CreatedSince: since}, func(order *models.Order) error {
+		if s.cacheLoaded(order, start) {
+			newer++
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Warnf("Failed to load orders newer than cache snapshot, loading all orders: %v", err)
+		s.cache.Clear()
+		return false
+	}
+	// Заказы, удаленные или архивированные после снимка, в том числе другими
+	// экземплярами сервиса
+	deleted, err := s.repo.DeletedOrderUIDs(s.ctx, since)
+	if err != nil {
+		logging.Warnf("Failed to load orders deleted after cache snapshot, loading all orders: %v", err)
+		s.cache.Clear()
+		return false
+	}
+	for _, orderUID := range deleted {
+		s.cache.Delete(orderUID)
+	}
+	// Заказы, записанные или удаленные, пока загружался снимок, могли вернуться
+	// в кэш из него
+	s.changed.evictSince(start, s.cache.Delete)
+	entries := s.cache.Size()
+	s.warmup.progress(entries, entries)
+
+	logging.Infof("Cache restored from snapshot with %d orders, %d newer orders loaded from DB, %d deleted orders evicted",
+		info.Entries, newer, len(deleted))
+	return true
+}
+
+// SaveSnapshot записывает снимок кэша на диск, если снимки включены
+func (s *OrderService) SaveSnapshot() error {
+	path := s.opts.Load().SnapshotPath
+	if path == "" {
+		return nil
+	}
+
+	// Снимок недогретого кэша с текущим водяным знаком потерял бы
+	// незагруженные заказы при следующем старте
+	if !s.warmup.done() {
+		logging.Infof("Cache warm-up is not finished, snapshot skipped")
+		return nil
+	}
+
+	// Водяной знак берем до копирования кэша: все, что записано в БД позже,
+	// будет догружено при следующем старте
+	watermark := time.Now()
+	info, err := s.cache.SaveSnapshotFile(path, watermark)
+	if err != nil {
+		logging.Errorf("Failed to save cache snapshot: %v", err)
+		return err
+	}
+
+	logging.Infof("Cache snapshot saved to %s with %d orders", path, info.Entries)
+	return nil
+}
+
+// snapshotLoop периодически сохраняет снимок кэша до остановки сервиса
+func (s *OrderService) snapshotLoop(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.SaveSnapshot()
+		}
+	}
+}
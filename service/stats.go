@@ -0,0 +1,90 @@
+package service
+
+import (
+	"sync/atomic"
+	"time"
+	"wb-orders-service/cache"
+	"wb-orders-service/repository"
+)
+
+// Stats - статистика обслуживания запросов заказов
+type Stats struct {
+	Cache        cache.Stats  `json:"cache"`
+	NegativeHits uint64       `json:"negative_hits"` // запросы отсутствующих заказов, не дошедшие до БД
+	NegativeSize int          `json:"negative_size"`
+	DBFallbacks  uint64       `json:"db_fallbacks"`   // промахи кэша, ушедшие в БД
+	DBLoadErrors uint64       `json:"db_load_errors"` // из них завершились ошибкой (в т.ч. "не найден")
+	Deduplicated uint64       `json:"deduplicated"`   // промахи, дождавшиеся уже идущей загрузки
+	LoadLatency  LatencyStats `json:"load_latency"`
+
+	// Пул соединений, если хранилище его использует
+	DBPool *repository.PoolStats `json:"db_pool,omitempty"`
+}
+
+// LatencyStats - время загрузки заказов из БД
+type LatencyStats struct {
+	Count   uint64  `json:"count"`
+	TotalMs float64 `json:"total_ms"`
+	AvgMs   float64 `json:"avg_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
+
+type serviceCounters struct {
+	negativeHits atomic.Uint64
+	dbFallbacks  atomic.Uint64
+	dbLoadErrors atomic.Uint64
+	deduplicated atomic.Uint64
+	loadCount    atomic.Uint64
+	loadTotal    atomic.Int64 // наносекунды
+	loadMax      atomic.Int64 // наносекунды
+}
+
+// observeLoad учитывает время одной загрузки из БД
+func (c *serviceCounters) observeLoad(d time.Duration, err error) {
+	c.dbFallbacks.Add(1)
+	if err != nil {
+		c.dbLoadErrors.Add(1)
+	}
+	c.loadCount.Add(1)
+	c.loadTotal.Add(int64(d))
+	for {
+		max := c.loadMax.Load()
+		if int64(d) <= max || c.loadMax.CompareAndSwap(max, int64(d)) {
+			return
+		}
+	}
+}
+
+// Stats возвращает статистику кэша и загрузок из БД
+func (s *OrderService) Stats() Stats {
+	count := s.counters.loadCount.Load()
+	total := time.Duration(s.counters.loadTotal.Load())
+
+	latency := LatencyStats{
+		Count:   count,
+		TotalMs: durationMs(total),
+		MaxMs:   durationMs(time.Duration(s.counters.loadMax.Load())),
+	}
+	if count > 0 {
+		latency.AvgMs = durationMs(total / time.Duration(count))
+	}
+
+	stats := Stats{
+		Cache:        s.cache.Stats(),
+		NegativeHits: s.counters.negativeHits.Load(),
+		NegativeSize: s.negative.Size(),
+		DBFallbacks:  s.counters.dbFallbacks.Load(),
+		DBLoadErrors: s.counters.dbLoadErrors.Load(),
+		Deduplicated: s.counters.deduplicated.Load(),
+		LoadLatency:  latency,
+	}
+	if pool, ok := s.repo.(repository.PoolReporter); ok {
+		poolStats := pool.PoolStats()
+		stats.DBPool = &poolStats
+	}
+	return stats
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
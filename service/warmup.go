@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"wb-orders-service/cache"
+	"wb-orders-service/logging"
+	"wb-orders-service/models"
+	"wb-orders-service/repository"
+)
+
+// Состояния прогрева кэша
+const (
+	WarmupLoading  = "loading"
+	WarmupRetrying = "retrying" // последняя попытка завершилась ошибкой
+	WarmupDone     = "done"
+)
+
+// Пауза между повторными попытками прогрева после ошибки
+const (
+	warmupRetryMin = time.Second
+	warmupRetryMax = time.Minute
+)
+
+var errCacheFull = errors.New("cache is full")
+
+// WarmupStatus - ход прогрева кэша
+type WarmupStatus struct {
+	State     string  `json:"state"`
+	Source    string  `json:"source,omitempty"` // snapshot или database
+	Loaded    int     `json:"loaded"`
+	Total     int     `json:"total"`
+	Ready     bool    `json:"ready"`
+	Error     string  `json:"error,omitempty"`
+	ElapsedMs float64 `json:"elapsed_ms"`
+}
+
+type warmup struct {
+	mu       sync.Mutex
+	state    string
+	source   string
+	loaded   int
+	total    int
+	err      error
+	started  time.Time
+	finished time.Time
+}
+
+func (w *warmup) begin(source string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.state = WarmupLoading
+	w.source = source
+	w.loaded = 0
+	w.total = 0
+}
+
+func (w *warmup) setTotal(total int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.total = total
+}
+
+func (w *warmup) progress(loaded, total int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.loaded = loaded
+	w.total = total
+}
+
+func (w *warmup) advance() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.loaded++
+}
+
+func (w *warmup) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.state = WarmupRetrying
+	w.err = err
+}
+
+func (w *warmup) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.state = WarmupDone
+	w.err = nil
+	w.finished = time.Now()
+}
+
+func (w *warmup) done() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.state == WarmupDone
+}
+
+// WarmupStatus возвращает ход прогрева кэша
+func (s *OrderService) WarmupStatus() WarmupStatus {
+	w := &s.warmup
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := WarmupStatus{
+		State:  w.state,
+		Source: w.source,
+		Loaded: w.loaded,
+		Total:  w.total,
+	}
+	if w.err != nil {
+		status.Error = w.err.Error()
+	}
+
+	end := w.finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	status.ElapsedMs = durationMs(end.Sub(w.started))
+
+	// Готов, когда прогрев завершен или загружена заданная доля заказов
+	ratio := s.opts.Load().WarmupReadyRatio
+	status.Ready = w.state == WarmupDone || ratio <= 0 ||
+		(w.total > 0 && float64(w.loaded) >= ratio*float64(w.total))
+	return status
+}
+
+// Ready сообщает, прогрет ли кэш достаточно для приема трафика
+func (s *OrderService) Ready() bool {
+	return s.WarmupStatus().Ready
+}
+
+// warmupLoop прогревает кэш в фоне, повторяя попытки после ошибок
+// до успеха или остановки сервиса. Пока кэш не прогрет, чтения идут в БД.
+func (s *OrderService) warmupLoop() {
+	defer s.wg.Done()
+
+	backoff := warmupRetryMin
+	for {
+		err := s.restoreCache()
+		if err == nil {
+			s.warmup.finish()
+			return
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		s.warmup.fail(err)
+		logging.Errorf("Cache warm-up failed, retrying in %s: %v", backoff, err)
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, warmupRetryMax)
+	}
+}
+
+// restoreCache загружает заказы в кэш: из снимка, если он есть и свежий,
+// иначе из БД от новых к старым, пока в кэше есть место.
+func (s *OrderService) restoreCache() error {
+	if s.opts.Load().SnapshotPath != "" && s.restoreFromSnapshot() {
+		return nil
+	}
+
+	s.warmup.begin("database")
+	total, err := s.repo.CountOrders(s.ctx)
+	if err != nil {
+		return err
+	}
+	s.warmup.setTotal(total)
+
+	start := time.Now()
+	skipped := 0
+	err = s.repo.StreamOrders(s.ctx, repository.StreamOptions{NewestFirst: true}, func(order *models.Order) error {
+		// Заказы, уже попавшие в кэш через чтение, не перезаписываются;
+		// записанные и удаленные во время прогрева пропускаются. Заказ, сегменту которого не
+		// хватило места, пропускается, пока есть место в других сегментах.
+		result := cache.WarmAdded
+		s.changed.cacheUnlessChanged(order.OrderUID, start, func() {
+			result = s.cache.Warm(order, s.orderTTL(order))
+		})
+		switch result {
+		case cache.WarmFull:
+			return errCacheFull
+		case cache.WarmSkipped:
+			skipped++
+			return nil
+		}
+		s.warmup.advance()
+		return nil
+	})
+	if errors.Is(err, errCacheFull) {
+		logging.Infof("Cache is full, warm-up stopped with %d of %d orders", s.cache.Size(), total)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logging.Infof("Cache warmed up with %d of %d orders, %d skipped for lack of space", s.cache.Size(), total, skipped)
+	return nil
+}